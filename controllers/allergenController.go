@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"golang-restrogo/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The allergen and dietary_tag validations check values against
+// models.Allergens and models.Dietary_tags, so the lists are kept in one place.
+func init() {
+	validate.RegisterValidation("allergen", func(field validator.FieldLevel) bool {
+		return contains(models.Allergens, field.Field().String())
+	})
+	validate.RegisterValidation("dietary_tag", func(field validator.FieldLevel) bool {
+		return contains(models.Dietary_tags, field.Field().String())
+	})
+}
+
+// allergenAliases maps the words guests and staff actually use to the
+// allergens they stand for.
+var allergenAliases = map[string][]string{
+	"dairy":       {"milk"},
+	"lactose":     {"milk"},
+	"egg":         {"eggs"},
+	"wheat":       {"gluten"},
+	"cereals":     {"gluten"},
+	"tree_nuts":   {"nuts"},
+	"tree-nuts":   {"nuts"},
+	"peanut":      {"peanuts"},
+	"soy":         {"soya"},
+	"sulfites":    {"sulphites"},
+	"sulphur":     {"sulphites"},
+	"shellfish":   {"crustaceans", "molluscs"},
+	"crustacean":  {"crustaceans"},
+	"mollusc":     {"molluscs"},
+	"mollusk":     {"molluscs"},
+	"mollusks":    {"molluscs"},
+	"sesame_seed": {"sesame"},
+}
+
+// GetAllergens lists the allergens and dietary tags foods can carry, and the
+// aliases accepted when filtering.
+func GetAllergens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"allergens":    models.Allergens,
+			"dietary_tags": models.Dietary_tags,
+			"aliases":      allergenAliases,
+		})
+	}
+}
+
+// parseAllergens turns a comma separated list of allergens or aliases into
+// allergens. It returns an error message for words it does not know.
+func parseAllergens(list string) ([]string, string) {
+	allergens := []string{}
+	for _, word := range strings.Split(list, ",") {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			continue
+		}
+		if aliased, found := allergenAliases[word]; found {
+			allergens = append(allergens, aliased...)
+			continue
+		}
+		if !contains(models.Allergens, word) {
+			return nil, fmt.Sprintf("unknown allergen %s", word)
+		}
+		allergens = append(allergens, word)
+	}
+	return allergens, ""
+}
+
+func parseDietaryTags(list string) ([]string, string) {
+	tags := []string{}
+	for _, word := range strings.Split(list, ",") {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			continue
+		}
+		if !contains(models.Dietary_tags, word) {
+			return nil, fmt.Sprintf("unknown diet %s", word)
+		}
+		tags = append(tags, word)
+	}
+	return tags, ""
+}
+
+// foodTagFilter builds the food query for the exclude_allergens and diet
+// query parameters, writing the error response itself when they are invalid.
+func foodTagFilter(c *gin.Context) (bson.D, bool) {
+	filter := bson.D{}
+
+	if list := c.Query("exclude_allergens"); list != "" {
+		allergens, msg := parseAllergens(list)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return nil, false
+		}
+		filter = append(filter, bson.E{Key: "allergens", Value: bson.D{{Key: "$nin", Value: allergens}}})
+	}
+
+	if list := c.Query("diet"); list != "" {
+		tags, msg := parseDietaryTags(list)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return nil, false
+		}
+		filter = append(filter, bson.E{Key: "dietary_tags", Value: bson.D{{Key: "$all", Value: tags}}})
+	}
+
+	return filter, true
+}
+
+// deriveFoodTags recomputes the allergens and dietary tags of the foods that
+// take them from their recipe: every allergen of any ingredient, and only the
+// dietary tags all ingredients share. Foods without a recipe keep what staff
+// declared, since an empty list would claim they are allergen free. Each
+// change is audited as made by the user of c.
+func deriveFoodTags(ctx context.Context, c *gin.Context, foodIds []string) error {
+	cursor, err := recipeCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return err
+	}
+	var recipes []models.Recipe
+	if err = cursor.All(ctx, &recipes); err != nil {
+		return err
+	}
+
+	for _, recipe := range recipes {
+		ingredientIds := []string{}
+		for _, recipeIngredient := range recipe.Ingredients {
+			ingredientIds = append(ingredientIds, recipeIngredient.Ingredient_id)
+		}
+
+		cursor, err := ingredientCollection.Find(ctx, bson.M{"ingredient_id": bson.M{"$in": ingredientIds}})
+		if err != nil {
+			return err
+		}
+		var ingredients []models.Ingredient
+		if err = cursor.All(ctx, &ingredients); err != nil {
+			return err
+		}
+
+		allergens := map[string]bool{}
+		tagCounts := map[string]int{}
+		for _, ingredient := range ingredients {
+			for _, allergen := range ingredient.Allergens {
+				allergens[allergen] = true
+			}
+			for _, tag := range ingredient.Dietary_tags {
+				tagCounts[tag]++
+			}
+		}
+		dietaryTags := map[string]bool{}
+		for tag, count := range tagCounts {
+			if count == len(ingredients) {
+				dietaryTags[tag] = true
+			}
+		}
+
+		audit := beginAudit(ctx, "foods", *recipe.Food_id)
+		_, err = foodCollection.UpdateOne(ctx,
+			bson.M{"food_id": recipe.Food_id, "tags_from_recipe": true},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "allergens", Value: sortedKeys(allergens)},
+				{Key: "dietary_tags", Value: sortedKeys(dietaryTags)},
+				{Key: "updated_at", Value: time.Now()},
+			}}, bumpVersion},
+		)
+		if err != nil {
+			return err
+		}
+		audit.record(ctx, c)
+	}
+	publicCache.invalidate()
+	return nil
+}
+
+// deriveFoodTagsForIngredient refreshes the foods whose recipe uses an
+// ingredient, after its allergens or dietary tags changed.
+func deriveFoodTagsForIngredient(ctx context.Context, c *gin.Context, ingredientId string) error {
+	foodIds, err := recipeCollection.Distinct(ctx, "food_id", bson.M{"ingredients.ingredient_id": ingredientId})
+	if err != nil {
+		return err
+	}
+
+	ids := []string{}
+	for _, foodId := range foodIds {
+		if id, ok := foodId.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return deriveFoodTags(ctx, c, ids)
+}
+
+// allergenNote is the line printed on kitchen tickets for a dish's allergens.
+func allergenNote(allergens []string) string {
+	if len(allergens) == 0 {
+		return ""
+	}
+	return "ALLERGENS: " + strings.ToUpper(strings.Join(allergens, ", "))
+}
+
+func nonNilStrings(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
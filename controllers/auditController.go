@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var auditCollection = database.OpenCollection(database.Client, "audit")
+
+// auditEntity is a collection whose changes are audited, and the field that
+// identifies its documents.
+type auditEntity struct {
+	collection *mongo.Collection
+	idField    string
+}
+
+var auditEntities = map[string]auditEntity{
+	"foods":      {foodCollection, "food_id"},
+	"menus":      {menuCollection, "menu_id"},
+	"tables":     {tableCollection, "table_id"},
+	"orders":     {orderCollection, "order_id"},
+	"orderItems": {orderItemCollection, "order_item_id"},
+	"invoices":   {invoiceCollection, "invoice_id"},
+	"users":      {userCollection, "user_id"},
+}
+
+// auditRedacted are fields whose values are never written to the audit log;
+// only the fact that they changed is.
+var auditRedacted = []string{"password", "token", "refreshtoken"}
+
+// GetAuditEntries lists the audit log, newest first, see listDocuments. It
+// is filtered with entity and id, e.g. ?entity=invoices&id=..., and with
+// actor_id and action. Only managers and admins can read it.
+func GetAuditEntries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if !requireRole(ctx, c, "ADMIN", "MANAGER") {
+			return
+		}
+
+		filter := bson.M{}
+		if entity := c.Query("entity"); entity != "" {
+			if _, found := auditEntities[entity]; !found {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "entity must be foods, menus, tables, orders, orderItems, invoices or users"})
+				return
+			}
+			filter["entity"] = entity
+		}
+		if id := c.Query("id"); id != "" {
+			filter["entity_id"] = id
+		}
+
+		page, ok := listDocuments(ctx, c, auditCollection, filter, listQuery{
+			Filters:     map[string]string{"actor_id": "string", "action": "string", "created_at": "date"},
+			Sorts:       []string{"created_at"},
+			DefaultSort: "-created_at",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// auditChange is a document about to be updated, remembered so the change
+// can be recorded once it is made.
+type auditChange struct {
+	entity string
+	id     string
+	before bson.M
+}
+
+// beginAudit reads the document id of entity as it is before an update.
+// Call record on the result once the update is done. Entities that are not
+// audited give nil, which records nothing.
+func beginAudit(ctx context.Context, entity, id string) *auditChange {
+	source, audited := auditEntities[entity]
+	if !audited {
+		return nil
+	}
+	change := &auditChange{entity: entity, id: id}
+	err := source.collection.FindOne(ctx, bson.M{source.idField: id}).Decode(&change.before)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Println("could not read", entity, id, "for the audit log:", err)
+	}
+	return change
+}
+
+// record reads the document again and logs the fields that changed. Nothing
+// is logged when the document was not changed. c may be nil for changes the
+// system makes on its own.
+func (change *auditChange) record(ctx context.Context, c *gin.Context) {
+	if change == nil {
+		return
+	}
+	source := auditEntities[change.entity]
+	var after bson.M
+	if err := source.collection.FindOne(ctx, bson.M{source.idField: change.id}).Decode(&after); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("could not read", change.entity, change.id, "for the audit log:", err)
+		}
+		return
+	}
+
+	action := "UPDATE"
+	if change.before == nil {
+		action = "CREATE"
+	}
+	writeAudit(ctx, c, change.entity, change.id, action, change.before, after)
+}
+
+// auditCreate logs a document that was just created, as it was inserted.
+func auditCreate(ctx context.Context, c *gin.Context, entity, id string, doc interface{}) {
+	raw, err := bson.Marshal(doc)
+	var after bson.M
+	if err == nil {
+		err = bson.Unmarshal(raw, &after)
+	}
+	if err != nil {
+		log.Println("could not encode", entity, id, "for the audit log:", err)
+		return
+	}
+	writeAudit(ctx, c, entity, id, "CREATE", nil, after)
+}
+
+// writeAudit logs the fields that differ between before and after. An audit
+// log that cannot be written does not undo the change, so failures are only
+// logged.
+func writeAudit(ctx context.Context, c *gin.Context, entity, id, action string, before, after bson.M) {
+	changes := auditDiff(before, after)
+	if len(changes) == 0 {
+		return
+	}
+
+	entry := models.AuditEntry{
+		ID:         primitive.NewObjectID(),
+		Entity:     entity,
+		Entity_id:  id,
+		Action:     action,
+		Changes:    changes,
+		Created_at: time.Now(),
+	}
+	entry.Audit_id = entry.ID.Hex()
+	if c != nil {
+		entry.Ip = c.ClientIP()
+		if userId := currentUserID(c); userId != "" {
+			entry.Actor_id = &userId
+		}
+	}
+
+	if _, err := auditCollection.InsertOne(ctx, entry); err != nil {
+		log.Println("could not write the audit log for", entity, id, ":", err)
+	}
+}
+
+// auditDiff lists the top-level fields that differ between before and after,
+// in name order. The id and updated_at are left out, as every change makes
+// them differ or not at all.
+func auditDiff(before, after bson.M) []models.FieldChange {
+	fields := []string{}
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, found := before[field]; !found {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _, field := range fields {
+		if field == "_id" || field == "updated_at" {
+			continue
+		}
+		previous, current := before[field], after[field]
+		if reflect.DeepEqual(previous, current) {
+			continue
+		}
+		if contains(auditRedacted, field) {
+			previous, current = redactedValue(previous), redactedValue(current)
+		}
+		changes = append(changes, models.FieldChange{Field: field, Before: previous, After: current})
+	}
+	return changes
+}
+
+func redactedValue(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return "[redacted]"
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var businessDayCollection = database.OpenCollection(database.Client, "businessDay")
+
+// businessDate is the trading day t falls on, in the server time zone.
+func businessDate(t time.Time) string {
+	return t.In(time.Local).Format("2006-01-02")
+}
+
+// checkDayOpen reports whether invoices of the business day of t can still be
+// changed, writing the error response itself when the day is closed.
+func checkDayOpen(ctx context.Context, c *gin.Context, t time.Time) bool {
+	msg, err := dayClosed(ctx, t)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking the business day"})
+		return false
+	}
+	if msg != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+		return false
+	}
+	return true
+}
+
+// dayClosed says why invoices of the business day of t can no longer be
+// changed, or returns an empty string while the day is open.
+func dayClosed(ctx context.Context, t time.Time) (string, error) {
+	date := businessDate(t)
+	closed, err := businessDayCollection.CountDocuments(ctx, bson.M{"business_date": date})
+	if err != nil || closed == 0 {
+		return "", err
+	}
+	return "business day " + date + " is closed", nil
+}
+
+// businessDateParam reads the :business_date parameter, writing the error
+// response itself when it is not a date.
+func businessDateParam(c *gin.Context) (string, time.Time, bool) {
+	date := c.Param("business_date")
+	start, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "business_date must be a date such as 2006-01-02"})
+		return "", time.Time{}, false
+	}
+	return date, start, true
+}
+
+func GetBusinessDays() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, businessDayCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"closed_by": "string"},
+			Sorts:       []string{"business_date", "closed_at"},
+			DefaultSort: "-business_date",
+			Projection:  bson.D{{Key: "z_report.drawers", Value: 0}},
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// GetBusinessDay returns a closed business day with its Z-report.
+func GetBusinessDay() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		date, _, ok := businessDateParam(c)
+		if !ok {
+			return
+		}
+
+		var day models.BusinessDay
+		err := businessDayCollection.FindOne(ctx, bson.M{"business_date": date}).Decode(&day)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "business day " + date + " is not closed"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the business day"})
+			return
+		}
+		c.JSON(http.StatusOK, day)
+	}
+}
+
+// GetXReport returns the figures of a business day so far, without closing
+// it, so it can be run mid-shift as often as needed.
+func GetXReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		date, start, ok := businessDateParam(c)
+		if !ok {
+			return
+		}
+
+		report, err := dayReport(ctx, date, start)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while building the X-report"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// CloseBusinessDay runs the Z-report of a business day and locks it: the
+// invoices created that day can no longer be changed and no drawer can be
+// opened on it. Every drawer of the day must be closed and every invoice of
+// the day paid first, since a pending invoice could not be paid afterwards.
+func CloseBusinessDay() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		date, start, ok := businessDateParam(c)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		if start.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a business day cannot be closed before it starts"})
+			return
+		}
+
+		cursor, err := drawerSessionCollection.Find(ctx, bson.M{"business_date": date, "status": "OPEN"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking open drawers"})
+			return
+		}
+		var openDrawers []models.DrawerSession
+		if err = cursor.All(ctx, &openDrawers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(openDrawers) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "close every drawer of the day first", "open_drawers": openDrawers})
+			return
+		}
+
+		pending, err := invoiceCollection.CountDocuments(ctx, bson.M{
+			"created_at":     bson.M{"$gte": start, "$lt": start.AddDate(0, 0, 1)},
+			"payment_status": "PENDING",
+			"deleted_at":     nil,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking pending invoices"})
+			return
+		}
+		if pending > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the day still has pending invoices; settle them first", "pending_invoices": pending})
+			return
+		}
+
+		report, err := dayReport(ctx, date, start)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while building the Z-report"})
+			return
+		}
+
+		day := models.BusinessDay{
+			ID:            primitive.NewObjectID(),
+			Business_date: date,
+			Closed_by:     currentUserID(c),
+			Closed_at:     now,
+			Z_report:      report,
+		}
+		// The upsert only inserts when the day is not closed yet, so two
+		// concurrent closes cannot both succeed.
+		result, err := businessDayCollection.UpdateOne(ctx,
+			bson.M{"business_date": date},
+			bson.D{{Key: "$setOnInsert", Value: day}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "business day could not be closed"})
+			return
+		}
+		if result.UpsertedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "business day " + date + " is already closed"})
+			return
+		}
+		c.JSON(http.StatusCreated, day)
+	}
+}
+
+// dayReport summarises the invoices created on the business day starting at
+// start by payment method and status, with the drawers of the day.
+func dayReport(ctx context.Context, date string, start time.Time) (models.DayReport, error) {
+	report := models.DayReport{
+		Business_date: date,
+		Generated_at:  time.Now(),
+		Invoices:      []models.InvoiceSummaryLine{},
+		Drawers:       []models.DrawerSession{},
+	}
+
+	cursor, err := invoiceCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "created_at", Value: bson.D{
+				{Key: "$gte", Value: start},
+				{Key: "$lt", Value: start.AddDate(0, 0, 1)},
+			}},
+			{Key: "deleted_at", Value: nil},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "payment_method", Value: "$payment_method"}, {Key: "payment_status", Value: "$payment_status"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "subtotal", Value: bson.D{{Key: "$sum", Value: "$subtotal"}}},
+			{Key: "discount", Value: bson.D{{Key: "$sum", Value: "$discount"}}},
+			{Key: "tax", Value: bson.D{{Key: "$sum", Value: "$tax"}}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$total"}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "payment_method", Value: "$_id.payment_method"},
+			{Key: "payment_status", Value: "$_id.payment_status"},
+			{Key: "count", Value: 1},
+			{Key: "subtotal", Value: 1},
+			{Key: "discount", Value: 1},
+			{Key: "tax", Value: 1},
+			{Key: "total", Value: 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "payment_status", Value: 1}, {Key: "payment_method", Value: 1}}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	if err = cursor.All(ctx, &report.Invoices); err != nil {
+		return report, err
+	}
+	for i := range report.Invoices {
+		line := &report.Invoices[i]
+		line.Subtotal = toFixed(line.Subtotal, 2)
+		line.Discount = toFixed(line.Discount, 2)
+		line.Tax = toFixed(line.Tax, 2)
+		line.Total = toFixed(line.Total, 2)
+		report.Totals.Count += line.Count
+		report.Totals.Subtotal += line.Subtotal
+		report.Totals.Discount += line.Discount
+		report.Totals.Tax += line.Tax
+		report.Totals.Total += line.Total
+	}
+	report.Totals.Subtotal = toFixed(report.Totals.Subtotal, 2)
+	report.Totals.Discount = toFixed(report.Totals.Discount, 2)
+	report.Totals.Tax = toFixed(report.Totals.Tax, 2)
+	report.Totals.Total = toFixed(report.Totals.Total, 2)
+
+	cursor, err = drawerSessionCollection.Find(ctx, bson.M{"business_date": date})
+	if err != nil {
+		return report, err
+	}
+	if err = cursor.All(ctx, &report.Drawers); err != nil {
+		return report, err
+	}
+	for i := range report.Drawers {
+		if report.Drawers[i].Status != "OPEN" {
+			continue
+		}
+		expected, err := expectedCash(ctx, report.Drawers[i])
+		if err != nil {
+			return report, err
+		}
+		report.Drawers[i].Expected_cash = &expected
+	}
+	return report, nil
+}
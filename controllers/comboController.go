@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var comboCollection = database.OpenCollection(database.Client, "combo")
+
+func GetCombos() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, comboCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"menu_id": "string"},
+			Sorts:       []string{"name", "price", "created_at", "updated_at"},
+			DefaultSort: "-created_at",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetCombo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		comboId := c.Param("combo_id")
+		var combo models.Combo
+
+		filter := bson.M{"combo_id": comboId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := comboCollection.FindOne(ctx, filter).Decode(&combo)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "combo not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the combo"})
+			return
+		}
+
+		setETag(c, combo.Version)
+		c.JSON(http.StatusOK, combo)
+	}
+}
+
+func CreateCombo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var combo models.Combo
+
+		if err := c.BindJSON(&combo); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(combo); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if combo.Menu_id != nil {
+			count, err := menuCollection.CountDocuments(ctx, bson.M{"menu_id": combo.Menu_id, "deleted_at": nil})
+			if err != nil || count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "menu was not found"})
+				return
+			}
+		}
+
+		if msg := normalizeComboSlots(ctx, combo.Slots); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		now := time.Now()
+		combo.ID = primitive.NewObjectID()
+		combo.Combo_id = combo.ID.Hex()
+		combo.Version = 1
+		combo.Created_at = now
+		combo.Updated_at = now
+		var price = toFixed(*combo.Price, 2)
+		combo.Price = &price
+
+		_, insertErr := comboCollection.InsertOne(ctx, combo)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "combo could not be created"})
+			return
+		}
+
+		setETag(c, combo.Version)
+		c.JSON(http.StatusOK, combo)
+	}
+}
+
+func UpdateCombo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		comboId := c.Param("combo_id")
+		var combo models.Combo
+
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := c.BindJSON(&combo); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		update := bson.D{}
+		if combo.Name != "" {
+			update = append(update, bson.E{Key: "name", Value: combo.Name})
+		}
+		if combo.Price != nil {
+			if *combo.Price <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "price must be greater than 0"})
+				return
+			}
+			update = append(update, bson.E{Key: "price", Value: toFixed(*combo.Price, 2)})
+		}
+		if combo.Menu_id != nil {
+			count, err := menuCollection.CountDocuments(ctx, bson.M{"menu_id": combo.Menu_id, "deleted_at": nil})
+			if err != nil || count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "menu was not found"})
+				return
+			}
+			update = append(update, bson.E{Key: "menu_id", Value: combo.Menu_id})
+		}
+		if combo.Slots != nil {
+			if validationErr := validate.Var(combo.Slots, "min=1,dive"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			if msg := normalizeComboSlots(ctx, combo.Slots); msg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			update = append(update, bson.E{Key: "slots", Value: combo.Slots})
+		}
+		update = append(update, bson.E{Key: "updated_at", Value: time.Now()})
+
+		filter := versionFilter("combo_id", comboId, version)
+		result, err := comboCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}, bumpVersion})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "combo update failed"})
+			return
+		}
+
+		if result.MatchedCount == 1 {
+			var updatedCombo models.Combo
+			err := comboCollection.FindOne(ctx, bson.M{"combo_id": comboId}).Decode(&updatedCombo)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated combo"})
+				return
+			}
+			setETag(c, updatedCombo.Version)
+			c.JSON(http.StatusOK, updatedCombo)
+			return
+		}
+
+		versionMismatch(ctx, c, comboCollection, "combo_id", comboId, "combo")
+	}
+}
+
+// normalizeComboSlots gives new slots their ids, makes sure the default food
+// is one of the allowed foods, drops repeated foods and checks that every food
+// exists. It returns an error message, or an empty string when the slots are
+// fine.
+func normalizeComboSlots(ctx context.Context, slots []models.ComboSlot) string {
+	for i := range slots {
+		slot := &slots[i]
+		if slot.Slot_id == "" {
+			slot.Slot_id = primitive.NewObjectID().Hex()
+		}
+
+		allowed := []string{slot.Default_food_id}
+		for _, foodId := range slot.Allowed_food_ids {
+			if !contains(allowed, foodId) {
+				allowed = append(allowed, foodId)
+			}
+		}
+		slot.Allowed_food_ids = allowed
+
+		count, err := foodCollection.CountDocuments(ctx, bson.M{"food_id": bson.M{"$in": allowed}, "deleted_at": nil})
+		if err != nil {
+			return "error while checking combo foods"
+		}
+		if int(count) != len(allowed) {
+			return fmt.Sprintf("slot %s refers to a food that was not found", slot.Name)
+		}
+	}
+	return ""
+}
+
+// resolveComboComponents fills every slot of a combo order item with the
+// requested food, or the slot default, checking substitutions are allowed.
+func resolveComboComponents(combo models.Combo, requested []models.ComboComponent) ([]models.ComboComponent, string) {
+	slots := map[string]models.ComboSlot{}
+	for _, slot := range combo.Slots {
+		slots[slot.Slot_id] = slot
+	}
+
+	chosen := map[string]string{}
+	for _, component := range requested {
+		slot, found := slots[component.SlotID]
+		if !found {
+			return nil, fmt.Sprintf("slot %s is not part of %s", component.SlotID, combo.Name)
+		}
+		if _, found := chosen[component.SlotID]; found {
+			return nil, fmt.Sprintf("slot %s was filled twice", slot.Name)
+		}
+		allowed := false
+		for _, foodId := range slot.Allowed_food_ids {
+			if foodId == component.FoodID {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Sprintf("food %s is not allowed in slot %s", component.FoodID, slot.Name)
+		}
+		chosen[component.SlotID] = component.FoodID
+	}
+
+	components := []models.ComboComponent{}
+	for _, slot := range combo.Slots {
+		foodId, found := chosen[slot.Slot_id]
+		if !found {
+			foodId = slot.Default_food_id
+		}
+		components = append(components, models.ComboComponent{SlotID: slot.Slot_id, FoodID: foodId})
+	}
+	return components, ""
+}
+
+// priceComboItem resolves the components of a combo order item, sets its unit
+// price to the bundle price and allocates that price across the components in
+// proportion to their standalone prices. Rounding leftovers go to the last one.
+func priceComboItem(ctx context.Context, combo models.Combo, orderItem *models.OrderItem) (string, error) {
+	components, msg := resolveComboComponents(combo, orderItem.Components)
+	if msg != "" {
+		return msg, nil
+	}
+
+	standalone := 0.0
+	prices := []float64{}
+	for i := range components {
+		var food models.Food
+		err := foodCollection.FindOne(ctx, bson.M{"food_id": components[i].FoodID, "deleted_at": nil}).Decode(&food)
+		if err == mongo.ErrNoDocuments {
+			return fmt.Sprintf("food %s was not found", components[i].FoodID), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		components[i].Name = getStringValue(food.Name)
+		prices = append(prices, *food.Price)
+		standalone += *food.Price
+	}
+
+	bundle := toFixed(*combo.Price, 2)
+	allocated := 0.0
+	for i := range components {
+		share := bundle / float64(len(components))
+		if standalone > 0 {
+			share = bundle * prices[i] / standalone
+		}
+		if i == len(components)-1 {
+			share = bundle - allocated
+		}
+		components[i].AllocatedPrice = toFixed(share, 2)
+		allocated += components[i].AllocatedPrice
+	}
+
+	orderItem.FoodID = nil
+	orderItem.Modifiers = nil
+	orderItem.Components = components
+	orderItem.UnitPrice = &bundle
+	return "", nil
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FoodCost is what a portion of a food costs to make and what it earns. The
+// cost is the food's own cost when it is set, or else its recipe priced at
+// the unit_cost of each ingredient. It is unknown when neither is available,
+// in which case Uncosted_ingredients lists the ingredients without a cost.
+// Margin is the price less the cost, and Food_cost_percentage is the cost as
+// a percentage of the price.
+type FoodCost struct {
+	Food_id              string   `json:"food_id"`
+	Name                 *string  `json:"name"`
+	Category             *string  `json:"category"`
+	Price                float64  `json:"price"`
+	Cost                 *float64 `json:"cost"`
+	Cost_source          string   `json:"cost_source,omitempty"`
+	Margin               *float64 `json:"margin"`
+	Food_cost_percentage *float64 `json:"food_cost_percentage"`
+	Uncosted_ingredients []string `json:"uncosted_ingredients,omitempty"`
+}
+
+func GetFoodCost() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": c.Param("food_id"), "deleted_at": nil}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+
+		costs, err := foodCosts(ctx, []models.Food{food})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while costing the food"})
+			return
+		}
+		c.JSON(http.StatusOK, costs[food.Food_id])
+	}
+}
+
+// foodCosts works out the cost of each food, keyed by food_id.
+func foodCosts(ctx context.Context, foods []models.Food) (map[string]FoodCost, error) {
+	costs := map[string]FoodCost{}
+	if len(foods) == 0 {
+		return costs, nil
+	}
+
+	foodIds := []string{}
+	for _, food := range foods {
+		foodIds = append(foodIds, food.Food_id)
+	}
+
+	cursor, err := recipeCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var recipes []models.Recipe
+	if err = cursor.All(ctx, &recipes); err != nil {
+		return nil, err
+	}
+
+	recipesByFood := map[string]models.Recipe{}
+	ingredientIds := []string{}
+	for _, recipe := range recipes {
+		recipesByFood[*recipe.Food_id] = recipe
+		for _, recipeIngredient := range recipe.Ingredients {
+			ingredientIds = append(ingredientIds, recipeIngredient.Ingredient_id)
+		}
+	}
+
+	cursor, err = ingredientCollection.Find(ctx, bson.M{"ingredient_id": bson.M{"$in": ingredientIds}})
+	if err != nil {
+		return nil, err
+	}
+	var ingredients []models.Ingredient
+	if err = cursor.All(ctx, &ingredients); err != nil {
+		return nil, err
+	}
+
+	ingredientsById := map[string]models.Ingredient{}
+	for _, ingredient := range ingredients {
+		ingredientsById[ingredient.Ingredient_id] = ingredient
+	}
+
+	for _, food := range foods {
+		cost := FoodCost{Food_id: food.Food_id, Name: food.Name, Category: food.Category}
+		if food.Price != nil {
+			cost.Price = *food.Price
+		}
+
+		if food.Cost != nil {
+			cost.Cost, cost.Cost_source = food.Cost, "manual"
+		} else if recipe, found := recipesByFood[food.Food_id]; found {
+			total := 0.0
+			for _, recipeIngredient := range recipe.Ingredients {
+				ingredient, found := ingredientsById[recipeIngredient.Ingredient_id]
+				if !found || ingredient.Unit_cost == nil {
+					name := recipeIngredient.Ingredient_id
+					if found {
+						name = ingredient.Name
+					}
+					cost.Uncosted_ingredients = append(cost.Uncosted_ingredients, name)
+					continue
+				}
+				total += recipeIngredient.Quantity * *ingredient.Unit_cost
+			}
+			if len(cost.Uncosted_ingredients) == 0 {
+				total = toFixed(total, 2)
+				cost.Cost, cost.Cost_source = &total, "recipe"
+			}
+		}
+
+		if cost.Cost != nil {
+			margin := toFixed(cost.Price-*cost.Cost, 2)
+			cost.Margin = &margin
+			if cost.Price > 0 {
+				percentage := toFixed(*cost.Cost/cost.Price*100, 2)
+				cost.Food_cost_percentage = &percentage
+			}
+		}
+		costs[food.Food_id] = cost
+	}
+	return costs, nil
+}
@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// deletable is an entity that can be soft deleted. param is the route
+// parameter holding the id. inUse says why a document cannot be deleted yet,
+// and parentDeleted why it cannot be restored, or return an empty string.
+type deletable struct {
+	collection    *mongo.Collection
+	idField       string
+	param         string
+	name          string
+	inUse         func(ctx context.Context, c *gin.Context, id string) (string, error)
+	parentDeleted func(ctx context.Context, doc bson.M) (string, error)
+}
+
+var deletables = map[string]deletable{
+	"foods":              {foodCollection, "food_id", "food_id", "food", foodInUse, menuDeleted},
+	"menus":              {menuCollection, "menu_id", "menu_id", "menu", menuInUse, nil},
+	"combos":             {comboCollection, "combo_id", "combo_id", "combo", nil, menuDeleted},
+	"ingredients":        {ingredientCollection, "ingredient_id", "ingredient_id", "ingredient", ingredientInUse, nil},
+	"suppliers":          {supplierCollection, "supplier_id", "supplier_id", "supplier", supplierInUse, nil},
+	"purchaseOrders":     {purchaseOrderCollection, "purchase_order_id", "purchase_order_id", "purchase order", purchaseOrderInUse, nil},
+	"tables":             {tableCollection, "table_id", "table_id", "table", tableInUse, sectionDeleted},
+	"sections":           {sectionCollection, "section_id", "section_id", "section", sectionInUse, nil},
+	"sectionAssignments": {sectionAssignmentCollection, "assignment_id", "assignment_id", "section assignment", nil, sectionDeleted},
+	"waitlist":           {waitlistCollection, "waitlist_id", "waitlist_id", "waitlist entry", nil, nil},
+	"orders":             {orderCollection, "order_id", "order_id", "order", orderInUse, nil},
+	"orderItems":         {orderItemCollection, "order_item_id", "orderItem_id", "order item", orderItemInUse, nil},
+	"invoices":           {invoiceCollection, "invoice_id", "invoice_id", "invoice", invoiceInUse, invoiceDayClosed},
+	"users":              {userCollection, "user_id", "user_id", "user", userInUse, nil},
+}
+
+// DeleteDocument soft deletes a document of entity: it is stamped with
+// deleted_at and deleted_by and left out of lists and lookups from then on.
+// Documents still referenced elsewhere cannot be deleted. Admins and
+// managers can delete, and only admins can delete users.
+func DeleteDocument(entity string) gin.HandlerFunc {
+	source := deletables[entity]
+	roles := []string{"ADMIN", "MANAGER"}
+	if entity == "users" {
+		roles = []string{"ADMIN"}
+	}
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if !requireRole(ctx, c, roles...) {
+			return
+		}
+
+		id := c.Param(source.param)
+		filter := bson.M{source.idField: id, "deleted_at": nil}
+		count, err := source.collection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the " + source.name})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": source.name + " not found"})
+			return
+		}
+
+		if source.inUse != nil {
+			msg, err := source.inUse(ctx, c, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking whether the " + source.name + " is in use"})
+				return
+			}
+			if msg != "" {
+				c.JSON(http.StatusConflict, gin.H{"error": msg})
+				return
+			}
+		}
+
+		now := time.Now()
+		set := bson.D{{Key: "deleted_at", Value: now}, {Key: "updated_at", Value: now}}
+		if userId := currentUserID(c); userId != "" {
+			set = append(set, bson.E{Key: "deleted_by", Value: userId})
+		}
+		audit := beginAudit(ctx, entity, id)
+		result, err := source.collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}, bumpVersion})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": source.name + " could not be deleted"})
+			return
+		}
+		if result.ModifiedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": source.name + " not found"})
+			return
+		}
+		audit.record(ctx, c)
+		publicCache.invalidate()
+
+		c.JSON(http.StatusOK, gin.H{"message": source.name + " deleted", source.idField: id, "deleted_at": now})
+	}
+}
+
+// RestoreDocument brings back a soft deleted document of entity. Only admins
+// can restore, and not while the document it belongs to is deleted.
+func RestoreDocument(entity string) gin.HandlerFunc {
+	source := deletables[entity]
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if !requireRole(ctx, c, "ADMIN") {
+			return
+		}
+
+		id := c.Param(source.param)
+		filter := bson.M{source.idField: id, "deleted_at": bson.M{"$ne": nil}}
+		var doc bson.M
+		if err := source.collection.FindOne(ctx, filter).Decode(&doc); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no deleted " + source.name + " has this id"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the " + source.name})
+			return
+		}
+
+		if source.parentDeleted != nil {
+			msg, err := source.parentDeleted(ctx, doc)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking the " + source.name})
+				return
+			}
+			if msg != "" {
+				c.JSON(http.StatusConflict, gin.H{"error": msg})
+				return
+			}
+		}
+
+		audit := beginAudit(ctx, entity, id)
+		_, err := source.collection.UpdateOne(ctx, filter, bson.D{
+			{Key: "$unset", Value: bson.D{{Key: "deleted_at", Value: ""}, {Key: "deleted_by", Value: ""}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+			bumpVersion,
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "sku is now used by another " + source.name})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": source.name + " could not be restored"})
+			return
+		}
+		audit.record(ctx, c)
+		publicCache.invalidate()
+
+		c.JSON(http.StatusOK, gin.H{"message": source.name + " restored", source.idField: id})
+	}
+}
+
+// includeDeleted reports whether include_deleted=true asks for deleted
+// documents too. Only admins may ask; for anyone else it writes the error
+// response itself and returns false as ok.
+func includeDeleted(ctx context.Context, c *gin.Context) (bool, bool) {
+	if c.Query("include_deleted") != "true" {
+		return false, true
+	}
+	if !requireRole(ctx, c, "ADMIN") {
+		return false, false
+	}
+	return true, true
+}
+
+// excludeDeleted leaves deleted documents out of a lookup, unless an admin
+// asked for them, see includeDeleted.
+func excludeDeleted(ctx context.Context, c *gin.Context, filter bson.M) bool {
+	include, ok := includeDeleted(ctx, c)
+	if ok && !include {
+		filter["deleted_at"] = nil
+	}
+	return ok
+}
+
+// liveCount counts the documents of collection matching filter that have not
+// been deleted.
+func liveCount(ctx context.Context, collection *mongo.Collection, filter bson.M) (int64, error) {
+	filter["deleted_at"] = nil
+	return collection.CountDocuments(ctx, filter)
+}
+
+func foodInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := liveCount(ctx, comboCollection, bson.M{"$or": bson.A{
+		bson.M{"slots.default_food_id": id},
+		bson.M{"slots.allowed_food_ids": id},
+	}})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "food is still part of a combo", nil
+}
+
+func menuInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := liveCount(ctx, foodCollection, bson.M{"menu_id": id})
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "menu still has foods; move or delete them first", nil
+	}
+	count, err = liveCount(ctx, comboCollection, bson.M{"menu_id": id})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "menu still has combos; move or delete them first", nil
+}
+
+func ingredientInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := recipeCollection.CountDocuments(ctx, bson.M{"ingredients.ingredient_id": id})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "ingredient is still used by a recipe", nil
+}
+
+func supplierInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := liveCount(ctx, ingredientCollection, bson.M{"supplier_id": id})
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "supplier still supplies ingredients", nil
+	}
+	count, err = liveCount(ctx, purchaseOrderCollection, bson.M{
+		"supplier_id": id,
+		"status":      bson.M{"$in": bson.A{"ORDERED", "PARTIALLY_RECEIVED"}},
+	})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "supplier still has purchase orders to deliver", nil
+}
+
+func purchaseOrderInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := purchaseOrderCollection.CountDocuments(ctx, bson.M{
+		"purchase_order_id": id,
+		"status":            bson.M{"$in": bson.A{"PARTIALLY_RECEIVED", "RECEIVED"}},
+	})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "purchase order has deliveries received against it", nil
+}
+
+func tableInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := liveCount(ctx, orderCollection, bson.M{
+		"table_id": id,
+		"status":   bson.M{"$in": openOrderStatuses},
+	})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "table has an open order", nil
+}
+
+func sectionInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := liveCount(ctx, tableCollection, bson.M{"section_id": id})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "section still has tables; move or delete them first", nil
+}
+
+func orderInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := liveCount(ctx, invoiceCollection, bson.M{"order_id": id})
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "order has an invoice", nil
+	}
+	count, err = liveCount(ctx, orderItemCollection, bson.M{"order_id": id})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "order still has items; void and delete them first", nil
+}
+
+func orderItemInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	count, err := orderItemCollection.CountDocuments(ctx, bson.M{"order_item_id": id, "voided_at": nil})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "void the order item before deleting it", nil
+}
+
+func invoiceInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	var invoice models.Invoice
+	if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": id}).Decode(&invoice); err != nil {
+		return "", err
+	}
+	if getStringValue(invoice.Payment_status) == "PAID" {
+		return "paid invoices cannot be deleted", nil
+	}
+	return dayClosed(ctx, invoice.Created_at)
+}
+
+func userInUse(ctx context.Context, c *gin.Context, id string) (string, error) {
+	if id == currentUserID(c) {
+		return "you cannot delete yourself", nil
+	}
+	last, err := lastAdmin(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if last {
+		return "the last admin cannot be deleted", nil
+	}
+	count, err := drawerSessionCollection.CountDocuments(ctx, bson.M{"cashier_id": id, "status": "OPEN"})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return "user still has an open cash drawer", nil
+}
+
+func menuDeleted(ctx context.Context, doc bson.M) (string, error) {
+	return parentDeleted(ctx, menuCollection, "menu_id", doc["menu_id"], "its menu is deleted; restore the menu first")
+}
+
+// invoiceDayClosed keeps invoices of a closed business day deleted, since
+// restoring one would change the day's figures after its Z-report.
+func invoiceDayClosed(ctx context.Context, doc bson.M) (string, error) {
+	createdAt, ok := doc["created_at"].(primitive.DateTime)
+	if !ok {
+		return "", nil
+	}
+	return dayClosed(ctx, createdAt.Time())
+}
+
+func sectionDeleted(ctx context.Context, doc bson.M) (string, error) {
+	return parentDeleted(ctx, sectionCollection, "section_id", doc["section_id"], "its section is deleted; restore the section first")
+}
+
+func parentDeleted(ctx context.Context, collection *mongo.Collection, idField string, id interface{}, msg string) (string, error) {
+	if id == nil {
+		return "", nil
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{idField: id, "deleted_at": bson.M{"$ne": nil}})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return msg, nil
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var drawerSessionCollection = database.OpenCollection(database.Client, "drawerSession")
+
+type CloseDrawerRequest struct {
+	Counted_cash *float64 `json:"counted_cash" validate:"required,gte=0"`
+}
+
+func GetDrawers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, drawerSessionCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"cashier_id": "string", "status": "string", "business_date": "string"},
+			Sorts:       []string{"opened_at", "closed_at", "business_date"},
+			DefaultSort: "-opened_at",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// GetDrawer returns a drawer session. The expected cash of an open session is
+// what the drawer should hold right now.
+func GetDrawer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		session, ok := findDrawerSession(ctx, c)
+		if !ok {
+			return
+		}
+		if session.Status == "OPEN" {
+			expected, err := expectedCash(ctx, session)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error while counting the drawer's cash sales"})
+				return
+			}
+			session.Expected_cash = &expected
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// OpenDrawer starts a drawer session for the logged-in cashier with the
+// opening float counted into it. A cashier works one drawer at a time.
+func OpenDrawer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var session models.DrawerSession
+		if err := c.BindJSON(&session); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(session); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		cashierId := currentUserID(c)
+		if cashierId == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "opening a drawer requires a logged-in user"})
+			return
+		}
+		now := time.Now()
+		if !checkDayOpen(ctx, c, now) {
+			return
+		}
+
+		open, err := drawerSessionCollection.CountDocuments(ctx, bson.M{"cashier_id": cashierId, "status": "OPEN"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking open drawers"})
+			return
+		}
+		if open > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "you already have an open drawer"})
+			return
+		}
+
+		openingFloat := toFixed(*session.Opening_float, 2)
+		session.ID = primitive.NewObjectID()
+		session.Drawer_session_id = session.ID.Hex()
+		session.Cashier_id = cashierId
+		session.Business_date = businessDate(now)
+		session.Status = "OPEN"
+		session.Opening_float = &openingFloat
+		session.Movements = []models.CashMovement{}
+		session.Counted_cash = nil
+		session.Expected_cash = nil
+		session.Variance = nil
+		session.Opened_at = now
+		session.Closed_at = nil
+		session.Created_at = now
+		session.Updated_at = now
+
+		if _, err := drawerSessionCollection.InsertOne(ctx, session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "drawer could not be opened"})
+			return
+		}
+		c.JSON(http.StatusCreated, session)
+	}
+}
+
+// AddCashMovement records cash put into or taken out of an open drawer.
+func AddCashMovement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var movement models.CashMovement
+		if err := c.BindJSON(&movement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(movement); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now := time.Now()
+		movement.Movement_id = primitive.NewObjectID().Hex()
+		movement.Amount = toFixed(movement.Amount, 2)
+		movement.Created_by = currentUserID(c)
+		movement.Created_at = now
+
+		result, err := drawerSessionCollection.UpdateOne(ctx,
+			bson.M{"drawer_session_id": c.Param("drawer_session_id"), "status": "OPEN"},
+			bson.D{
+				{Key: "$push", Value: bson.D{{Key: "movements", Value: movement}}},
+				{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cash movement could not be recorded"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no open drawer with this id"})
+			return
+		}
+		c.JSON(http.StatusCreated, movement)
+	}
+}
+
+// CloseDrawer closes a drawer session with the cash counted in it, recording
+// what was expected and the variance between the two.
+func CloseDrawer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request CloseDrawerRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		session, ok := findDrawerSession(ctx, c)
+		if !ok {
+			return
+		}
+		if session.Status != "OPEN" {
+			c.JSON(http.StatusConflict, gin.H{"error": "drawer is already closed"})
+			return
+		}
+
+		expected, err := expectedCash(ctx, session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while counting the drawer's cash sales"})
+			return
+		}
+		counted := toFixed(*request.Counted_cash, 2)
+		variance := toFixed(counted-expected, 2)
+		now := time.Now()
+
+		result, err := drawerSessionCollection.UpdateOne(ctx,
+			bson.M{"drawer_session_id": session.Drawer_session_id, "status": "OPEN"},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "status", Value: "CLOSED"},
+				{Key: "counted_cash", Value: counted},
+				{Key: "expected_cash", Value: expected},
+				{Key: "variance", Value: variance},
+				{Key: "closed_at", Value: now},
+				{Key: "updated_at", Value: now},
+			}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "drawer could not be closed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "drawer is already closed"})
+			return
+		}
+
+		session.Status = "CLOSED"
+		session.Counted_cash = &counted
+		session.Expected_cash = &expected
+		session.Variance = &variance
+		session.Closed_at = &now
+		session.Updated_at = now
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+func findDrawerSession(ctx context.Context, c *gin.Context) (models.DrawerSession, bool) {
+	var session models.DrawerSession
+	err := drawerSessionCollection.FindOne(ctx, bson.M{"drawer_session_id": c.Param("drawer_session_id")}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "drawer session not found"})
+		return session, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the drawer session"})
+		return session, false
+	}
+	return session, true
+}
+
+// expectedCash is what a drawer should hold: its opening float, the cash
+// invoices paid into it and the cash moved in, less the cash moved out.
+func expectedCash(ctx context.Context, session models.DrawerSession) (float64, error) {
+	cursor, err := invoiceCollection.Find(ctx, bson.M{
+		"drawer_session_id": session.Drawer_session_id,
+		"payment_method":    "CASH",
+		"payment_status":    "PAID",
+	})
+	if err != nil {
+		return 0, err
+	}
+	var invoices []models.Invoice
+	if err = cursor.All(ctx, &invoices); err != nil {
+		return 0, err
+	}
+
+	expected := 0.0
+	if session.Opening_float != nil {
+		expected = *session.Opening_float
+	}
+	for _, invoice := range invoices {
+		expected += invoice.Total
+	}
+	for _, movement := range session.Movements {
+		if movement.Type == "OUT" {
+			expected -= movement.Amount
+		} else {
+			expected += movement.Amount
+		}
+	}
+	return toFixed(expected, 2), nil
+}
+
+// recordPayment finds the drawer a payment goes into: cash is taken into the
+// open drawer of the logged-in cashier, other methods into none. It writes the
+// error response itself when cash is taken without an open drawer.
+func recordPayment(ctx context.Context, c *gin.Context, paymentMethod *string) (*string, bool) {
+	if paymentMethod == nil || *paymentMethod != "CASH" {
+		return nil, true
+	}
+
+	var session models.DrawerSession
+	err := drawerSessionCollection.FindOne(ctx, bson.M{"cashier_id": currentUserID(c), "status": "OPEN"}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "open a cash drawer before taking cash payments"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while finding your cash drawer"})
+		return nil, false
+	}
+	return &session.Drawer_session_id, true
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"golang-restrogo/helper/export"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportFlushRows is how many rows are written between flushes to the client.
+const exportFlushRows = 500
+
+// exportSource is a collection that can be exported, with the columns
+// available, named after their fields, in their default order.
+type exportSource struct {
+	collection *mongo.Collection
+	columns    []string
+}
+
+var exportSources = map[string]exportSource{
+	"invoices": {invoiceCollection, []string{
+		"invoice_id", "order_id", "created_at", "payment_status", "payment_method", "paid_at",
+		"subtotal", "discount", "tax", "total", "payment_due_date", "drawer_session_id",
+	}},
+	"orders": {orderCollection, []string{
+		"order_id", "table_id", "status", "source", "waiter_id", "order_date", "created_at", "closed_at",
+	}},
+	"orderItems": {orderItemCollection, []string{
+		"order_item_id", "order_id", "food_id", "combo_id", "quantity", "unit_price", "created_at", "voided_at",
+	}},
+}
+
+// Export streams the invoices, orders or order items created between from
+// and to, leaving out deleted ones, as csv (the default), xlsx or ndjson.
+// Rows are written as they are read from the database, oldest first. columns
+// picks and orders the columns, and dates are written in tz.
+func Export() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		entity := c.Param("entity")
+		source, found := exportSources[entity]
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "exports are available for invoices, orders and orderItems"})
+			return
+		}
+		format, found := export.Formats[c.DefaultQuery("format", "csv")]
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, xlsx or ndjson"})
+			return
+		}
+		location, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tz must be an IANA time zone such as Europe/Paris"})
+			return
+		}
+		from, to, msg := reportRange(c, location)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		columns := source.columns
+		if value := c.Query("columns"); value != "" {
+			columns = strings.Split(value, ",")
+			for _, column := range columns {
+				if !contains(source.columns, column) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "columns must be among " + strings.Join(source.columns, ", ")})
+					return
+				}
+			}
+		}
+
+		projection := bson.D{}
+		for _, column := range columns {
+			projection = append(projection, bson.E{Key: column, Value: 1})
+		}
+		opts := options.Find().
+			SetProjection(projection).
+			SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+		cursor, err := source.collection.Find(ctx, bson.M{"created_at": bson.M{"$gte": from, "$lt": to}, "deleted_at": nil}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while reading " + entity})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		filename := fmt.Sprintf("%s-%s-%s.%s", entity, from.In(location).Format("20060102"), to.In(location).Format("20060102"), format.Extension)
+		c.Header("Content-Type", format.ContentType)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Status(http.StatusOK)
+
+		// From here on the response has started, so errors can only cut it
+		// short.
+		writer, err := format.New(c.Writer, columns, location)
+		if err != nil {
+			log.Println("export of", entity, "failed:", err)
+			return
+		}
+		cells := make([]interface{}, len(columns))
+		rows := 0
+		for cursor.Next(ctx) {
+			for i, column := range columns {
+				cells[i] = exportCell(cursor.Current.Lookup(column))
+			}
+			if err := writer.WriteRow(cells); err != nil {
+				log.Println("export of", entity, "failed:", err)
+				return
+			}
+			rows++
+			if rows%exportFlushRows == 0 {
+				if err := writer.Flush(); err != nil {
+					log.Println("export of", entity, "failed:", err)
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			log.Println("export of", entity, "failed:", err)
+			return
+		}
+		if err := writer.Close(); err != nil {
+			log.Println("export of", entity, "failed:", err)
+		}
+	}
+}
+
+// exportCell converts a field of a document to a cell. Missing fields and
+// nulls are empty cells.
+func exportCell(value bson.RawValue) interface{} {
+	switch value.Type {
+	case 0, bsontype.Null, bsontype.Undefined:
+		return nil
+	case bsontype.String:
+		return value.StringValue()
+	case bsontype.Double:
+		return value.Double()
+	case bsontype.Int32:
+		return value.Int32()
+	case bsontype.Int64:
+		return value.Int64()
+	case bsontype.Boolean:
+		return value.Boolean()
+	case bsontype.DateTime:
+		return value.Time()
+	case bsontype.ObjectID:
+		return value.ObjectID().Hex()
+	}
+	return value.String()
+}
@@ -1,85 +1,71 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"golang-restrogo/database"
+	"golang-restrogo/helper"
 	"golang-restrogo/models"
+	"golang-restrogo/storage"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
 	"math"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
 
+func init() {
+	validate.RegisterValidation("food_image", validFoodImage)
+}
+
+// validFoodImage accepts a URL, or where the store serves an uploaded image,
+// which for the local store is a path on this server.
+func validFoodImage(field validator.FieldLevel) bool {
+	value := field.Field().String()
+	return validate.Var(value, "url") == nil || storage.IsStoredURL(value)
+}
+
+// GetFoods lists foods a page at a time, see listDocuments, with the allergen
+// and dietary filters of foodTagFilter.
 func GetFoods() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Pagination parameters
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
-
-		page, err := strconv.Atoi(c.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
-		}
-
-		startIndex := (page - 1) * recordPerPage
-		if v := c.Query("startIndex"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
-				startIndex = parsed
-			}
-		}
-
-		// MongoDB aggregation for pagination
-		matchStage := bson.D{{Key: "$match", Value: bson.D{}}}
-		groupStage := bson.D{
-			{Key: "$group", Value: bson.D{
-				{Key: "_id", Value: nil},
-				{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
-				{Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
-			}},
-		}
-		projectStage := bson.D{
-			{Key: "$project", Value: bson.D{
-				{Key: "_id", Value: 0},
-				{Key: "total_count", Value: 1},
-				{Key: "food_items", Value: bson.D{
-					{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage}},
-				}},
-			}},
-		}
-
-		cursor, err := foodCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage,
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing food items"})
+		filter, ok := foodTagFilter(c)
+		if !ok {
 			return
 		}
 
-		var allFoods []bson.M
-		if err = cursor.All(ctx, &allFoods); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		page, ok := listDocuments(ctx, c, foodCollection, filter, listQuery{
+			Filters:     map[string]string{"menu_id": "string", "category": "string", "is_available": "bool"},
+			Sorts:       []string{"name", "price", "category", "sort_order", "created_at", "updated_at"},
+			DefaultSort: "-created_at",
+		})
+		if !ok {
 			return
 		}
 
-		if len(allFoods) == 0 {
-			c.JSON(http.StatusOK, gin.H{"message": "No foods found", "data": []interface{}{}})
+		if err := annotateAvailability(ctx, page.Data); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking food availability"})
 			return
 		}
 
-		c.JSON(http.StatusOK, allFoods[0])
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -91,14 +77,25 @@ func GetFood() gin.HandlerFunc {
 		foodId := c.Param("food_id")
 		var food models.Food
 
-		err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food)
+		filter := bson.M{"food_id": foodId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := foodCollection.FindOne(ctx, filter).Decode(&food)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "error occurred while fetching the food item",
 			})
 			return
 		}
-		c.JSON(http.StatusOK, food)
+
+		availability, err := foodAvailability(ctx, []models.Food{food})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking food availability"})
+			return
+		}
+		setETag(c, food.Version)
+		c.JSON(http.StatusOK, FoodView{Food: food, FoodAvailability: availability[food.Food_id]})
 	}
 }
 
@@ -122,27 +119,51 @@ func CreateFood() gin.HandlerFunc {
 		}
 
 		// Check if referenced menu exists
-		err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
+		err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id, "deleted_at": nil}).Decode(&menu)
 		if err != nil {
 			msg := fmt.Sprintf("menu was not found")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
 
+		if msg := normalizeModifierGroups(food.Modifier_groups); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
 		now := time.Now()
 		food.Created_at = now
 		food.Updated_at = now
 		food.ID = primitive.NewObjectID()
 		food.Food_id = food.ID.Hex()
+		food.Version = 1
 		var num = toFixed(*food.Price, 2)
 		food.Price = &num
+		if food.Cost != nil {
+			cost := toFixed(*food.Cost, 2)
+			food.Cost = &cost
+		}
 
 		result, insertErr := foodCollection.InsertOne(ctx, food)
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": "sku is already used by another food"})
+			return
+		}
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item was not created"})
 			return
 		}
+		publicCache.invalidate()
+		auditCreate(ctx, c, "foods", food.Food_id, food)
 
+		if food.Tags_from_recipe != nil && *food.Tags_from_recipe {
+			if err := deriveFoodTags(ctx, c, []string{food.Food_id}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "food item was created but its allergens could not be derived"})
+				return
+			}
+		}
+
+		setETag(c, food.Version)
 		c.JSON(http.StatusOK, result)
 	}
 }
@@ -155,6 +176,10 @@ func UpdateFood() gin.HandlerFunc {
 		foodId := c.Param("food_id")
 		var food models.Food
 
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
 		if err := c.BindJSON(&food); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -169,35 +194,432 @@ func UpdateFood() gin.HandlerFunc {
 			var num = toFixed(*food.Price, 2)
 			updateObj = append(updateObj, bson.E{Key: "price", Value: num})
 		}
+		if food.Cost != nil {
+			if *food.Cost < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cost must not be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "cost", Value: toFixed(*food.Cost, 2)})
+		}
 		if food.Food_image != nil && *food.Food_image != "" {
+			if validationErr := validate.Var(*food.Food_image, "food_image"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "food_image must be a URL, or upload the image instead"})
+				return
+			}
 			updateObj = append(updateObj, bson.E{Key: "food_image", Value: *food.Food_image})
 		}
+		if food.Description != nil {
+			if validationErr := validate.Var(*food.Description, "max=1000"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "description must be at most 1000 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "description", Value: *food.Description})
+		}
+		if food.Category != nil {
+			updateObj = append(updateObj, bson.E{Key: "category", Value: *food.Category})
+		}
+		if food.Sort_order != nil {
+			updateObj = append(updateObj, bson.E{Key: "sort_order", Value: *food.Sort_order})
+		}
+		if food.Is_available != nil {
+			updateObj = append(updateObj, bson.E{Key: "is_available", Value: *food.Is_available})
+		}
+		if food.Allergens != nil {
+			if validationErr := validate.Var(food.Allergens, "dive,allergen"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "allergens must be among the 14 EU allergens, see GET /allergens"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "allergens", Value: food.Allergens})
+		}
+		if food.Dietary_tags != nil {
+			if validationErr := validate.Var(food.Dietary_tags, "dive,dietary_tag"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "dietary_tags must be vegan, vegetarian or halal"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "dietary_tags", Value: food.Dietary_tags})
+		}
+		if food.Tags_from_recipe != nil {
+			updateObj = append(updateObj, bson.E{Key: "tags_from_recipe", Value: *food.Tags_from_recipe})
+		}
+		if food.Sku != nil {
+			if validationErr := validate.Var(*food.Sku, "max=64"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sku must be at most 64 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "sku", Value: *food.Sku})
+		}
+		if food.Modifier_groups != nil {
+			if validationErr := validate.Var(food.Modifier_groups, "dive"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			if msg := normalizeModifierGroups(food.Modifier_groups); msg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "modifier_groups", Value: food.Modifier_groups})
+		}
 
 		now := time.Now()
 		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: now})
 
-		filter := bson.M{"food_id": foodId}
-		update := bson.D{{Key: "$set", Value: updateObj}}
+		filter := versionFilter("food_id", foodId, version)
+		update := bson.D{{Key: "$set", Value: updateObj}, bumpVersion}
 
+		audit := beginAudit(ctx, "foods", foodId)
 		result, err := foodCollection.UpdateOne(ctx, filter, update)
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "sku is already used by another food"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "food update failed"})
 			return
 		}
+		if result.MatchedCount == 0 {
+			versionMismatch(ctx, c, foodCollection, "food_id", foodId, "food")
+			return
+		}
+		publicCache.invalidate()
+
+		if err := deriveFoodTags(ctx, c, []string{foodId}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food was updated but its allergens could not be derived"})
+			return
+		}
+		audit.record(ctx, c)
 
 		var updatedFood models.Food
-		if result.MatchedCount == 1 {
-			err := foodCollection.FindOne(ctx, filter).Decode(&updatedFood)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated food"})
+		err = foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&updatedFood)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated food"})
+			return
+		}
+		setETag(c, updatedFood.Version)
+		c.JSON(http.StatusOK, updatedFood)
+	}
+}
+
+const maxFoodImageSize = 5 << 20
+const maxFoodImagePixels = 40000000
+const foodThumbnailSize = 320
+
+var foodImageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// UploadFoodImage stores the image sent in the "image" form field, along with
+// a thumbnail, and points the food at them. The type is taken from the file's
+// content, not from what the client claims. Like other updates it needs the
+// food's ETag in If-Match.
+func UploadFoodImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFoodImageSize+1<<20)
+
+		fileHeader, err := c.FormFile("image")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "image must be at most 5 MB"})
 				return
 			}
-			c.JSON(http.StatusOK, updatedFood)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+			return
+		}
+		if fileHeader.Size > maxFoodImageSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "image must be at most 5 MB"})
 			return
 		}
 
-		c.JSON(http.StatusOK, result)
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image file could not be read"})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxFoodImageSize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image file could not be read"})
+			return
+		}
+
+		contentType := http.DetectContentType(data)
+		extension, allowed := foodImageExtensions[contentType]
+		if !allowed {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "image must be a JPEG, PNG or GIF"})
+			return
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image could not be decoded"})
+			return
+		}
+		if config.Width*config.Height > maxFoodImagePixels {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image dimensions are too large"})
+			return
+		}
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, versionFilter("food_id", foodId, version)).Decode(&food); err != nil {
+			if err == mongo.ErrNoDocuments {
+				versionMismatch(ctx, c, foodCollection, "food_id", foodId, "food")
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching the food item"})
+			return
+		}
+
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image could not be decoded"})
+			return
+		}
+		var thumbnail bytes.Buffer
+		if err := jpeg.Encode(&thumbnail, helper.Thumbnail(img, foodThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "thumbnail could not be generated"})
+			return
+		}
+
+		// A fresh name per upload, so caches never serve the previous image.
+		name := "foods/" + foodId + "/" + primitive.NewObjectID().Hex()
+		imageKey := name + extension
+		thumbnailKey := name + "_thumb.jpg"
+
+		imageURL, err := storage.Store.Put(ctx, imageKey, data, contentType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "image could not be stored"})
+			return
+		}
+		thumbnailURL, err := storage.Store.Put(ctx, thumbnailKey, thumbnail.Bytes(), "image/jpeg")
+		if err != nil {
+			storage.Store.Delete(ctx, imageKey)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "thumbnail could not be stored"})
+			return
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "food_image", Value: imageURL},
+			{Key: "food_thumbnail", Value: thumbnailURL},
+			{Key: "image_keys", Value: []string{imageKey, thumbnailKey}},
+			{Key: "updated_at", Value: time.Now()},
+		}}, bumpVersion}
+		var updatedFood models.Food
+		audit := beginAudit(ctx, "foods", foodId)
+		err = foodCollection.FindOneAndUpdate(ctx, versionFilter("food_id", foodId, version), update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updatedFood)
+		if err != nil {
+			storage.Store.Delete(ctx, imageKey)
+			storage.Store.Delete(ctx, thumbnailKey)
+			if err == mongo.ErrNoDocuments {
+				versionMismatch(ctx, c, foodCollection, "food_id", foodId, "food")
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food update failed"})
+			return
+		}
+		publicCache.invalidate()
+		audit.record(ctx, c)
+
+		// The previous upload is no longer referenced; losing it is harmless
+		// if the delete fails.
+		for _, key := range food.Image_keys {
+			storage.Store.Delete(ctx, key)
+		}
+
+		setETag(c, updatedFood.Version)
+		c.JSON(http.StatusOK, updatedFood)
+	}
+}
+
+// FoodAvailability is whether a food can be sold right now. A food is 86'd
+// when staff switched it off or a recipe ingredient has run out.
+type FoodAvailability struct {
+	Available          bool   `json:"available"`
+	Unavailable_reason string `json:"unavailable_reason,omitempty"`
+}
+
+type FoodView struct {
+	models.Food
+	FoodAvailability
+}
+
+type UnavailableFood struct {
+	Food_id string `json:"food_id"`
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+}
+
+// foodAvailability works out the availability of each food, keyed by food_id.
+func foodAvailability(ctx context.Context, foods []models.Food) (map[string]FoodAvailability, error) {
+	availability := map[string]FoodAvailability{}
+	if len(foods) == 0 {
+		return availability, nil
+	}
+
+	foodIds := []string{}
+	for _, food := range foods {
+		foodIds = append(foodIds, food.Food_id)
+	}
+
+	cursor, err := recipeCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var recipes []models.Recipe
+	if err = cursor.All(ctx, &recipes); err != nil {
+		return nil, err
+	}
+
+	recipesByFood := map[string]models.Recipe{}
+	ingredientIds := []string{}
+	for _, recipe := range recipes {
+		recipesByFood[*recipe.Food_id] = recipe
+		for _, recipeIngredient := range recipe.Ingredients {
+			ingredientIds = append(ingredientIds, recipeIngredient.Ingredient_id)
+		}
+	}
+
+	cursor, err = ingredientCollection.Find(ctx, bson.M{"ingredient_id": bson.M{"$in": ingredientIds}})
+	if err != nil {
+		return nil, err
+	}
+	var ingredients []models.Ingredient
+	if err = cursor.All(ctx, &ingredients); err != nil {
+		return nil, err
+	}
+
+	ingredientsById := map[string]models.Ingredient{}
+	for _, ingredient := range ingredients {
+		ingredientsById[ingredient.Ingredient_id] = ingredient
+	}
+
+	for _, food := range foods {
+		status := FoodAvailability{Available: true}
+		if food.Is_available != nil && !*food.Is_available {
+			status = FoodAvailability{Unavailable_reason: "marked unavailable"}
+		} else if recipe, found := recipesByFood[food.Food_id]; found {
+			for _, recipeIngredient := range recipe.Ingredients {
+				ingredient, found := ingredientsById[recipeIngredient.Ingredient_id]
+				if !found || ingredient.Stock_quantity == nil || *ingredient.Stock_quantity < recipeIngredient.Quantity {
+					name := recipeIngredient.Ingredient_id
+					if found {
+						name = ingredient.Name
+					}
+					status = FoodAvailability{Unavailable_reason: fmt.Sprintf("out of %s", name)}
+					break
+				}
+			}
+		}
+		availability[food.Food_id] = status
+	}
+
+	return availability, nil
+}
+
+// annotateAvailability adds available/unavailable_reason to raw food documents.
+func annotateAvailability(ctx context.Context, foodItems []bson.M) error {
+	foods := []models.Food{}
+	for _, item := range foodItems {
+		raw, err := bson.Marshal(item)
+		if err != nil {
+			return err
+		}
+		var food models.Food
+		if err = bson.Unmarshal(raw, &food); err != nil {
+			return err
+		}
+		foods = append(foods, food)
+	}
+
+	availability, err := foodAvailability(ctx, foods)
+	if err != nil {
+		return err
+	}
+
+	for i, doc := range foodItems {
+		status := availability[foods[i].Food_id]
+		doc["available"] = status.Available
+		if !status.Available {
+			doc["unavailable_reason"] = status.Unavailable_reason
+		}
+	}
+	return nil
+}
+
+// unavailableFoods returns the 86'd foods among foodIds, including ids that do
+// not match any food at all.
+func unavailableFoods(ctx context.Context, foodIds []string) ([]UnavailableFood, error) {
+	cursor, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var foods []models.Food
+	if err = cursor.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+
+	availability, err := foodAvailability(ctx, foods)
+	if err != nil {
+		return nil, err
+	}
+
+	foodsById := map[string]models.Food{}
+	for _, food := range foods {
+		foodsById[food.Food_id] = food
+	}
+
+	unavailable := []UnavailableFood{}
+	seen := map[string]bool{}
+	for _, foodId := range foodIds {
+		if seen[foodId] {
+			continue
+		}
+		seen[foodId] = true
+
+		food, found := foodsById[foodId]
+		if !found {
+			unavailable = append(unavailable, UnavailableFood{Food_id: foodId, Reason: "food not found"})
+			continue
+		}
+		if status := availability[foodId]; !status.Available {
+			unavailable = append(unavailable, UnavailableFood{Food_id: foodId, Name: getStringValue(food.Name), Reason: status.Unavailable_reason})
+		}
+	}
+	return unavailable, nil
+}
+
+// normalizeModifierGroups checks the selection limits of modifier groups and
+// gives new groups and options their ids. It returns an error message, or an
+// empty string when the groups are fine.
+func normalizeModifierGroups(groups []models.ModifierGroup) string {
+	for i := range groups {
+		group := &groups[i]
+		if group.Max_selections > 0 && group.Max_selections < group.Min_selections {
+			return fmt.Sprintf("modifier group %s: max_selections is lower than min_selections", group.Name)
+		}
+		if group.Max_selections > len(group.Options) {
+			return fmt.Sprintf("modifier group %s: max_selections exceeds the number of options", group.Name)
+		}
+		if group.Group_id == "" {
+			group.Group_id = primitive.NewObjectID().Hex()
+		}
+		for j := range group.Options {
+			if group.Options[j].Option_id == "" {
+				group.Options[j].Option_id = primitive.NewObjectID().Hex()
+			}
+			group.Options[j].Price_delta = toFixed(group.Options[j].Price_delta, 2)
+		}
 	}
+	return ""
 }
 
 func round(num float64) int {
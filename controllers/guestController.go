@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/helper"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GuestOrderPack is what a guest submits from the table QR code page.
+type GuestOrderPack struct {
+	Order_items []models.OrderItem `json:"order_items" validate:"required,min=1,max=50,dive"`
+}
+
+// GetGuestTable tells the guest page which table a QR code belongs to.
+func GetGuestTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		table, ok := guestTable(ctx, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"table_id": table.Table_id, "number": table.Number})
+	}
+}
+
+// CreateGuestOrder places an order for the table of a QR code without a staff
+// login. The order waits in PENDING_CONFIRMATION until a waiter confirms it,
+// so nothing reaches the kitchen or stock before then.
+func CreateGuestOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		table, ok := guestTable(ctx, c)
+		if !ok {
+			return
+		}
+
+		var pack GuestOrderPack
+		if err := c.BindJSON(&pack); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var order models.Order
+		order.ID = primitive.NewObjectID()
+		order.Order_id = order.ID.Hex()
+		order.Version = 1
+		for i := range pack.Order_items {
+			pack.Order_items[i].OrderID = order.Order_id
+		}
+
+		if validationErr := validate.Struct(pack); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if !checkOrderItems(ctx, c, pack.Order_items) {
+			return
+		}
+
+		now := time.Now()
+		status := "PENDING_CONFIRMATION"
+		source := "GUEST"
+		order.Table_id = &table.Table_id
+		order.Status = &status
+		order.Source = &source
+		order.Order_Date = now
+		order.Created_at = now
+		order.Updated_at = now
+
+		for i := range pack.Order_items {
+			orderItem := &pack.Order_items[i]
+			orderItem.ID = primitive.NewObjectID()
+			orderItem.OrderItemID = orderItem.ID.Hex()
+			orderItem.Version = 1
+			orderItem.CreatedAt = now
+			orderItem.UpdatedAt = now
+		}
+
+		if err := insertOrderWithItems(ctx, c, order, pack.Order_items); err != nil {
+			rollbackResponse(c, err, "order creation")
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"order": order, "order_items": pack.Order_items})
+	}
+}
+
+// guestTable resolves the table of the token in the URL, writing the error
+// response itself when the token is invalid or was rotated away.
+func guestTable(ctx context.Context, c *gin.Context) (models.Table, bool) {
+	var table models.Table
+
+	tableId, version, msg := helper.ValidateTableToken(c.Param("token"))
+	if msg != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+		return table, false
+	}
+
+	err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId, "deleted_at": nil}).Decode(&table)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return table, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the table"})
+		return table, false
+	}
+
+	if table.Qr_token_version != version {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "this QR code is no longer valid, please ask your waiter"})
+		return table, false
+	}
+
+	return table, true
+}
@@ -0,0 +1,588 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-restrogo/models"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxImportSize = 10 << 20
+const maxImportRows = 5000
+
+// ImportRowResult is what importing a row did, or would do in a dry run.
+// Row is the line of a CSV file, or the position in a JSON array.
+type ImportRowResult struct {
+	Row    int      `json:"row"`
+	Sku    *string  `json:"sku"`
+	Action string   `json:"action,omitempty"`
+	Id     string   `json:"id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type ImportResult struct {
+	Dry_run bool              `json:"dry_run"`
+	Atomic  bool              `json:"atomic"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// importRow is a row read from the request, as JSON whatever the input format.
+type importRow struct {
+	number int
+	raw    json.RawMessage
+	errors []string
+}
+
+// importPlan is the document a valid row will be written as.
+type importPlan struct {
+	ImportRowResult
+	id      primitive.ObjectID
+	version int
+	doc     interface{}
+}
+
+// EnsureImportIndexes makes SKUs unique among foods and among menus, so rows
+// can be matched to what an earlier import created. Documents without a SKU
+// are left out of the index.
+func EnsureImportIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, collection := range []*mongo.Collection{foodCollection, menuCollection} {
+		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "sku", Value: 1}},
+			Options: options.Index().SetName("sku_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "sku", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+		})
+		if err != nil {
+			log.Println("could not create the", collection.Name(), "sku index:", err)
+		}
+	}
+}
+
+// ImportFoods creates or updates foods from a CSV file or a JSON array, see
+// importDocuments. Rows name their menu with menu_id, or with menu_sku.
+func ImportFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		rows, ok := readImportRows(c, reflect.TypeOf(models.Food{}), []string{"menu_sku"})
+		if !ok {
+			return
+		}
+
+		plans := []importPlan{}
+		skus := map[string]int{}
+		for _, row := range rows {
+			plans = append(plans, planFoodImport(ctx, row, skus))
+		}
+
+		importDocuments(ctx, c, "foods", plans, func(ctx context.Context, written []importPlan) error {
+			publicCache.invalidate()
+			foodIds := []string{}
+			for _, plan := range written {
+				food := plan.doc.(models.Food)
+				if food.Tags_from_recipe != nil && *food.Tags_from_recipe {
+					foodIds = append(foodIds, food.Food_id)
+				}
+			}
+			if len(foodIds) == 0 {
+				return nil
+			}
+			return deriveFoodTags(ctx, c, foodIds)
+		})
+	}
+}
+
+// ImportMenus creates or updates menus from a CSV file or a JSON array, see
+// importDocuments.
+func ImportMenus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		rows, ok := readImportRows(c, reflect.TypeOf(models.Menu{}), nil)
+		if !ok {
+			return
+		}
+
+		plans := []importPlan{}
+		skus := map[string]int{}
+		for _, row := range rows {
+			plans = append(plans, planMenuImport(ctx, row, skus))
+		}
+
+		importDocuments(ctx, c, "menus", plans, func(ctx context.Context, written []importPlan) error {
+			publicCache.invalidate()
+			return nil
+		})
+	}
+}
+
+func planFoodImport(ctx context.Context, row importRow, skus map[string]int) importPlan {
+	plan := importPlan{ImportRowResult: ImportRowResult{Row: row.number, Errors: row.errors}}
+	if len(plan.Errors) > 0 {
+		return plan
+	}
+
+	fields, refs, msg := importFields(row.raw, []string{"food_id", "food_thumbnail", "created_at", "updated_at", "version", "deleted_at", "deleted_by"}, "menu_sku")
+	if msg != "" {
+		return plan.fail(msg)
+	}
+	plan.Sku = refs.Sku
+
+	var food models.Food
+	found, msg := findBySku(ctx, foodCollection, refs.Sku, skus, row.number, &food)
+	if msg != "" {
+		return plan.fail(msg)
+	}
+	if err := decodeImportFields(fields, &food); err != nil {
+		return plan.fail(err.Error())
+	}
+
+	if refs.Menu_sku != nil {
+		var menu models.Menu
+		if err := menuCollection.FindOne(ctx, bson.M{"sku": *refs.Menu_sku, "deleted_at": nil}).Decode(&menu); err != nil {
+			return plan.fail("no menu has the sku " + *refs.Menu_sku)
+		}
+		food.Menu_id = &menu.Menu_id
+	} else if food.Menu_id != nil {
+		count, err := menuCollection.CountDocuments(ctx, bson.M{"menu_id": *food.Menu_id, "deleted_at": nil})
+		if err != nil || count == 0 {
+			plan.Errors = append(plan.Errors, "menu was not found")
+		}
+	}
+
+	if validationErr := validate.Struct(food); validationErr != nil {
+		plan.Errors = append(plan.Errors, strings.Split(validationErr.Error(), "\n")...)
+	}
+	if len(plan.Errors) > 0 {
+		return plan
+	}
+	if msg := normalizeModifierGroups(food.Modifier_groups); msg != "" {
+		return plan.fail(msg)
+	}
+
+	now := time.Now()
+	if !found {
+		food.ID = primitive.NewObjectID()
+		food.Food_id = food.ID.Hex()
+		food.Created_at = now
+	}
+	food.Updated_at = now
+	plan.version = food.Version
+	food.Version++
+	price := toFixed(*food.Price, 2)
+	food.Price = &price
+	if food.Cost != nil {
+		cost := toFixed(*food.Cost, 2)
+		food.Cost = &cost
+	}
+
+	plan.id, plan.Id, plan.doc = food.ID, food.Food_id, food
+	plan.Action = importAction(found)
+	return plan
+}
+
+func planMenuImport(ctx context.Context, row importRow, skus map[string]int) importPlan {
+	plan := importPlan{ImportRowResult: ImportRowResult{Row: row.number, Errors: row.errors}}
+	if len(plan.Errors) > 0 {
+		return plan
+	}
+
+	// The menu id is serialised as food_id.
+	fields, refs, msg := importFields(row.raw, []string{"food_id", "created_at", "updated_at", "version", "deleted_at", "deleted_by"})
+	if msg != "" {
+		return plan.fail(msg)
+	}
+	plan.Sku = refs.Sku
+
+	var menu models.Menu
+	found, msg := findBySku(ctx, menuCollection, refs.Sku, skus, row.number, &menu)
+	if msg != "" {
+		return plan.fail(msg)
+	}
+	if err := decodeImportFields(fields, &menu); err != nil {
+		return plan.fail(err.Error())
+	}
+
+	if validationErr := validate.Struct(menu); validationErr != nil {
+		return plan.fail(strings.Split(validationErr.Error(), "\n")...)
+	}
+	if msg := checkMenuSchedule(menu); msg != "" {
+		return plan.fail(msg)
+	}
+
+	now := time.Now()
+	if !found {
+		menu.ID = primitive.NewObjectID()
+		menu.Menu_id = menu.ID.Hex()
+		menu.Created_at = &now
+	}
+	menu.Updated_at = &now
+	plan.version = menu.Version
+	menu.Version++
+
+	plan.id, plan.Id, plan.doc = menu.ID, menu.Menu_id, menu
+	plan.Action = importAction(found)
+	return plan
+}
+
+func (plan importPlan) fail(errors ...string) importPlan {
+	plan.Errors = append(plan.Errors, errors...)
+	return plan
+}
+
+func importAction(found bool) string {
+	if found {
+		return "update"
+	}
+	return "create"
+}
+
+// importRefs are the fields of a row that say which documents it refers to.
+type importRefs struct {
+	Sku      *string `json:"sku"`
+	Menu_sku *string `json:"menu_sku"`
+}
+
+// importFields splits a row into the fields to decode onto the document and
+// its references. Rows cannot set the fields in readOnly, nor ids; the
+// fields in refFields are only references and are not decoded.
+func importFields(raw json.RawMessage, readOnly []string, refFields ...string) (map[string]json.RawMessage, importRefs, string) {
+	var refs importRefs
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, refs, "row must be a JSON object"
+	}
+	if err := json.Unmarshal(raw, &refs); err != nil {
+		return nil, refs, "sku must be a string"
+	}
+	if refs.Sku != nil && *refs.Sku == "" {
+		refs.Sku = nil
+	}
+
+	for key := range fields {
+		if strings.EqualFold(key, "id") || strings.EqualFold(key, "_id") {
+			return nil, refs, key + " cannot be imported"
+		}
+		for _, field := range readOnly {
+			if strings.EqualFold(key, field) {
+				return nil, refs, key + " cannot be imported"
+			}
+		}
+	}
+	for _, field := range refFields {
+		delete(fields, field)
+	}
+	return fields, refs, ""
+}
+
+// findBySku decodes the document with sku into doc, if there is one. A SKU
+// used by two rows of the same import is an error on the second.
+func findBySku(ctx context.Context, collection *mongo.Collection, sku *string, skus map[string]int, row int, doc interface{}) (bool, string) {
+	if sku == nil {
+		return false, ""
+	}
+	if first, seen := skus[*sku]; seen {
+		return false, fmt.Sprintf("sku %s is already used by row %d", *sku, first)
+	}
+	skus[*sku] = row
+
+	err := collection.FindOne(ctx, bson.M{"sku": *sku, "deleted_at": nil}).Decode(doc)
+	if err == mongo.ErrNoDocuments {
+		return false, ""
+	}
+	if err != nil {
+		return false, "error while looking up the sku"
+	}
+	return true, ""
+}
+
+// decodeImportFields sets the fields of a row on doc, leaving those the row
+// does not have as they are, so updates only change what was imported.
+func decodeImportFields(fields map[string]json.RawMessage, doc interface{}) error {
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(doc)
+}
+
+// readImportRows reads the rows of a CSV body (by its Content-Type) or of a
+// JSON array, writing the error response itself when the body is unreadable.
+func readImportRows(c *gin.Context, model reflect.Type, refColumns []string) ([]importRow, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	var rows []importRow
+	var msg string
+	if strings.Contains(c.ContentType(), "csv") {
+		rows, msg = csvImportRows(c.Request.Body, model, refColumns)
+	} else {
+		var items []json.RawMessage
+		if err := json.NewDecoder(c.Request.Body).Decode(&items); err != nil {
+			msg = "body must be a JSON array of objects, or a CSV file sent as text/csv"
+		}
+		for i, item := range items {
+			rows = append(rows, importRow{number: i + 1, raw: item})
+		}
+	}
+	if msg == "" && len(rows) == 0 {
+		msg = "there is nothing to import"
+	}
+	if msg == "" && len(rows) > maxImportRows {
+		msg = fmt.Sprintf("at most %d rows can be imported at once", maxImportRows)
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return nil, false
+	}
+	return rows, true
+}
+
+// csvImportRows turns the lines of a CSV file into JSON rows. The header
+// names the JSON fields of model; cells are converted to the type of their
+// field, lists are separated with |, nested values are written as JSON, and
+// empty cells are left out.
+func csvImportRows(body io.Reader, model reflect.Type, refColumns []string) ([]importRow, string) {
+	fieldTypes := map[string]reflect.Type{}
+	for i := 0; i < model.NumField(); i++ {
+		name := strings.Split(model.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fieldTypes[name] = model.Field(i).Type
+		}
+	}
+	for _, column := range refColumns {
+		fieldTypes[column] = reflect.TypeOf("")
+	}
+
+	reader := csv.NewReader(body)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, "the CSV file must start with a header line"
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		if _, found := fieldTypes[header[i]]; !found {
+			return nil, "unknown column " + header[i]
+		}
+	}
+
+	rows := []importRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err.Error()
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := importRow{number: line}
+		fields := map[string]interface{}{}
+		for i, cell := range record {
+			if cell = strings.TrimSpace(cell); cell == "" {
+				continue
+			}
+			value, err := csvCellValue(fieldTypes[header[i]], cell)
+			if err != nil {
+				row.errors = append(row.errors, header[i]+": "+err.Error())
+				continue
+			}
+			fields[header[i]] = value
+		}
+		row.raw, _ = json.Marshal(fields)
+		rows = append(rows, row)
+	}
+	return rows, ""
+}
+
+func csvCellValue(fieldType reflect.Type, cell string) (interface{}, error) {
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return cell, nil
+	}
+
+	switch fieldType.Kind() {
+	case reflect.String:
+		return cell, nil
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return value, nil
+	case reflect.Int:
+		value, err := strconv.Atoi(cell)
+		if err != nil {
+			return nil, fmt.Errorf("must be a whole number")
+		}
+		return value, nil
+	case reflect.Bool:
+		value, err := strconv.ParseBool(cell)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return value, nil
+	case reflect.Slice:
+		if fieldType.Elem().Kind() == reflect.String {
+			values := []string{}
+			for _, value := range strings.Split(cell, "|") {
+				if value = strings.TrimSpace(value); value != "" {
+					values = append(values, value)
+				}
+			}
+			return values, nil
+		}
+	}
+	if !json.Valid([]byte(cell)) {
+		return nil, fmt.Errorf("must be written as JSON")
+	}
+	return json.RawMessage(cell), nil
+}
+
+// importDocuments writes the planned rows, then runs afterWrite on those
+// written. With dry_run=true nothing is written and the plans are reported.
+// By default valid rows are written and invalid ones reported; with
+// atomic=true nothing is written unless every row is valid, and the rows are
+// written in a single transaction. Every row written is audited.
+func importDocuments(ctx context.Context, c *gin.Context, entity string, plans []importPlan, afterWrite func(context.Context, []importPlan) error) {
+	collection := auditEntities[entity].collection
+	result := ImportResult{
+		Dry_run: c.Query("dry_run") == "true",
+		Atomic:  c.Query("atomic") == "true",
+		Total:   len(plans),
+		Rows:    []ImportRowResult{},
+	}
+
+	valid := []importPlan{}
+	for _, plan := range plans {
+		if len(plan.Errors) == 0 {
+			valid = append(valid, plan)
+		}
+	}
+	result.Failed = len(plans) - len(valid)
+
+	if result.Atomic && result.Failed > 0 {
+		result.Rows = importRowResults(plans)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing was imported because some rows are invalid", "import": result})
+		return
+	}
+
+	written := valid
+	if !result.Dry_run {
+		audits := map[int]*auditChange{}
+		for _, plan := range valid {
+			audits[plan.Row] = beginAudit(ctx, entity, plan.Id)
+		}
+
+		if result.Atomic {
+			err := writeImportAtomically(ctx, collection, valid)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "nothing was imported: " + err.Error()})
+				return
+			}
+		} else {
+			written = []importPlan{}
+			for i := range plans {
+				if len(plans[i].Errors) > 0 {
+					continue
+				}
+				if err := writeImportPlan(ctx, collection, plans[i]); err != nil {
+					plans[i].Errors = []string{importWriteError(err)}
+					plans[i].Action, plans[i].Id = "", ""
+					result.Failed++
+					continue
+				}
+				written = append(written, plans[i])
+			}
+		}
+
+		err := afterWrite(ctx, written)
+		for _, plan := range written {
+			audits[plan.Row].record(ctx, c)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "rows were imported but could not be processed: " + err.Error()})
+			return
+		}
+	}
+
+	for _, plan := range written {
+		if plan.Action == "create" {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+	result.Rows = importRowResults(plans)
+	c.JSON(http.StatusOK, result)
+}
+
+func importRowResults(plans []importPlan) []ImportRowResult {
+	rows := []ImportRowResult{}
+	for _, plan := range plans {
+		rows = append(rows, plan.ImportRowResult)
+	}
+	return rows
+}
+
+func writeImportPlan(ctx context.Context, collection *mongo.Collection, plan importPlan) error {
+	if plan.Action == "create" {
+		_, err := collection.InsertOne(ctx, plan.doc)
+		return err
+	}
+	// The row replaces the document as it was read; if it has been changed
+	// since, the row fails rather than undo that change.
+	result, err := collection.ReplaceOne(ctx, versionFilter("_id", plan.id, plan.version), plan.doc)
+	if err == nil && result.MatchedCount == 0 {
+		err = errImportChanged
+	}
+	return err
+}
+
+var errImportChanged = errors.New("the document was changed during the import; import the row again")
+
+// writeImportAtomically writes every plan or none.
+func writeImportAtomically(ctx context.Context, collection *mongo.Collection, plans []importPlan) error {
+	return inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+		for _, plan := range plans {
+			if err := writeImportPlan(sessionCtx, collection, plan); err != nil {
+				return fmt.Errorf("row %d: %s", plan.Row, importWriteError(err))
+			}
+		}
+		return nil
+	})
+}
+
+func importWriteError(err error) string {
+	if mongo.IsDuplicateKeyError(err) {
+		return "sku is already used"
+	}
+	return err.Error()
+}
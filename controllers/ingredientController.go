@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ingredientCollection = database.OpenCollection(database.Client, "ingredient")
+
+func GetIngredients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, ingredientCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"unit": "string", "supplier_id": "string"},
+			Sorts:       []string{"name", "stock_quantity", "reorder_level", "unit_cost", "created_at", "updated_at"},
+			DefaultSort: "name",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		ingredientId := c.Param("ingredient_id")
+		var ingredient models.Ingredient
+
+		filter := bson.M{"ingredient_id": ingredientId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := ingredientCollection.FindOne(ctx, filter).Decode(&ingredient)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "ingredient not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the ingredient"})
+			return
+		}
+
+		setETag(c, ingredient.Version)
+		c.JSON(http.StatusOK, ingredient)
+	}
+}
+
+func CreateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var ingredient models.Ingredient
+
+		if err := c.BindJSON(&ingredient); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(ingredient); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if ingredient.Supplier_id != nil {
+			count, err := supplierCollection.CountDocuments(ctx, bson.M{"supplier_id": ingredient.Supplier_id, "deleted_at": nil})
+			if err != nil || count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "supplier was not found"})
+				return
+			}
+		}
+
+		now := time.Now()
+		ingredient.ID = primitive.NewObjectID()
+		ingredient.Ingredient_id = ingredient.ID.Hex()
+		ingredient.Version = 1
+		ingredient.Created_at = now
+		ingredient.Updated_at = now
+
+		_, insertErr := ingredientCollection.InsertOne(ctx, ingredient)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ingredient could not be created"})
+			return
+		}
+
+		setETag(c, ingredient.Version)
+		c.JSON(http.StatusOK, ingredient)
+	}
+}
+
+func UpdateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		ingredientId := c.Param("ingredient_id")
+		var ingredient models.Ingredient
+
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := c.BindJSON(&ingredient); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		update := bson.D{}
+		if ingredient.Name != "" {
+			update = append(update, bson.E{Key: "name", Value: ingredient.Name})
+		}
+		if ingredient.Unit != "" {
+			if validationErr := validate.Var(ingredient.Unit, "eq=g|eq=kg|eq=ml|eq=l|eq=pcs"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unit must be one of g, kg, ml, l or pcs"})
+				return
+			}
+			update = append(update, bson.E{Key: "unit", Value: ingredient.Unit})
+		}
+		if ingredient.Stock_quantity != nil {
+			update = append(update, bson.E{Key: "stock_quantity", Value: ingredient.Stock_quantity})
+		}
+		if ingredient.Reorder_level != nil {
+			update = append(update, bson.E{Key: "reorder_level", Value: ingredient.Reorder_level})
+		}
+		if ingredient.Reorder_quantity != nil {
+			update = append(update, bson.E{Key: "reorder_quantity", Value: ingredient.Reorder_quantity})
+		}
+		if ingredient.Supplier_id != nil {
+			count, err := supplierCollection.CountDocuments(ctx, bson.M{"supplier_id": ingredient.Supplier_id, "deleted_at": nil})
+			if err != nil || count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "supplier was not found"})
+				return
+			}
+			update = append(update, bson.E{Key: "supplier_id", Value: ingredient.Supplier_id})
+		}
+		if ingredient.Unit_cost != nil {
+			update = append(update, bson.E{Key: "unit_cost", Value: ingredient.Unit_cost})
+		}
+		if ingredient.Allergens != nil {
+			if validationErr := validate.Var(ingredient.Allergens, "dive,allergen"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "allergens must be among the 14 EU allergens, see GET /allergens"})
+				return
+			}
+			update = append(update, bson.E{Key: "allergens", Value: ingredient.Allergens})
+		}
+		if ingredient.Dietary_tags != nil {
+			if validationErr := validate.Var(ingredient.Dietary_tags, "dive,dietary_tag"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "dietary_tags must be vegan, vegetarian or halal"})
+				return
+			}
+			update = append(update, bson.E{Key: "dietary_tags", Value: ingredient.Dietary_tags})
+		}
+		update = append(update, bson.E{Key: "updated_at", Value: time.Now()})
+
+		filter := versionFilter("ingredient_id", ingredientId, version)
+		result, err := ingredientCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}, bumpVersion})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ingredient update failed"})
+			return
+		}
+
+		if result.MatchedCount == 1 && (ingredient.Allergens != nil || ingredient.Dietary_tags != nil) {
+			if err := deriveFoodTagsForIngredient(ctx, c, ingredientId); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "ingredient was updated but the allergens of its foods could not be derived"})
+				return
+			}
+		}
+
+		if result.MatchedCount == 1 {
+			var updatedIngredient models.Ingredient
+			err := ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": ingredientId}).Decode(&updatedIngredient)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated ingredient"})
+				return
+			}
+			setETag(c, updatedIngredient.Version)
+			c.JSON(http.StatusOK, updatedIngredient)
+			return
+		}
+
+		versionMismatch(ctx, c, ingredientCollection, "ingredient_id", ingredientId, "ingredient")
+	}
+}
+
+// deductStock takes the ingredients for quantity portions of a food out of
+// stock. Foods without a recipe are not tracked and are left alone. Stock may
+// go negative: the kitchen already used the ingredient, the count was just off.
+func deductStock(ctx context.Context, foodId string, quantity float64) error {
+	return adjustStockForFood(ctx, foodId, -quantity)
+}
+
+// restoreStock puts back what deductStock took, e.g. when an item is voided.
+func restoreStock(ctx context.Context, foodId string, quantity float64) error {
+	return adjustStockForFood(ctx, foodId, quantity)
+}
+
+func adjustStockForFood(ctx context.Context, foodId string, portions float64) error {
+	var recipe models.Recipe
+	err := recipeCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&recipe)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, recipeIngredient := range recipe.Ingredients {
+		_, err := ingredientCollection.UpdateOne(ctx,
+			bson.M{"ingredient_id": recipeIngredient.Ingredient_id},
+			bson.D{
+				{Key: "$inc", Value: bson.D{{Key: "stock_quantity", Value: recipeIngredient.Quantity * portions}, {Key: "version", Value: 1}}},
+				{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
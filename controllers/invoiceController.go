@@ -2,7 +2,10 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"golang-restrogo/database"
@@ -26,19 +29,15 @@ func GetInvoices() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		cursor, err := invoiceCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error listing invoices"})
-			return
-		}
-
-		var invoices []bson.M
-		if err = cursor.All(ctx, &invoices); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error parsing invoices"})
+		page, ok := listDocuments(ctx, c, invoiceCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"order_id": "string", "payment_method": "string", "payment_status": "string", "created_at": "date"},
+			Sorts:       []string{"payment_due_date", "created_at", "updated_at"},
+			DefaultSort: "-created_at",
+		})
+		if !ok {
 			return
 		}
-
-		c.JSON(http.StatusOK, invoices)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -49,7 +48,11 @@ func GetInvoice() gin.HandlerFunc {
 
 		invoiceID := c.Param("invoice_id")
 		var invoice models.Invoice
-		err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceID}).Decode(&invoice)
+		filter := bson.M{"invoice_id": invoiceID}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := invoiceCollection.FindOne(ctx, filter).Decode(&invoice)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice not found"})
 			return
@@ -75,6 +78,7 @@ func GetInvoice() gin.HandlerFunc {
 			Order_details:    allOrderItems[0]["order_items"],
 		}
 
+		setETag(c, invoice.Version)
 		c.JSON(http.StatusOK, view)
 	}
 }
@@ -98,6 +102,15 @@ func CreateInvoice() gin.HandlerFunc {
 			return
 		}
 
+		if !checkDayOpen(ctx, c, time.Now()) {
+			return
+		}
+
+		if msg := priceInvoice(ctx, &invoice); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
 		// Default values
 		status := "PENDING"
 		if invoice.Payment_status == nil {
@@ -109,6 +122,17 @@ func CreateInvoice() gin.HandlerFunc {
 		invoice.Updated_at = now
 		invoice.ID = primitive.NewObjectID()
 		invoice.Invoice_id = invoice.ID.Hex()
+		invoice.Version = 1
+		invoice.Paid_at = nil
+		invoice.Drawer_session_id = nil
+		if *invoice.Payment_status == "PAID" {
+			drawerSessionId, ok := recordPayment(ctx, c, invoice.Payment_method)
+			if !ok {
+				return
+			}
+			invoice.Paid_at = &now
+			invoice.Drawer_session_id = drawerSessionId
+		}
 
 		// Validation
 		if err := validate.Struct(invoice); err != nil {
@@ -116,12 +140,29 @@ func CreateInvoice() gin.HandlerFunc {
 			return
 		}
 
-		result, err := invoiceCollection.InsertOne(ctx, invoice)
+		// An invoice paid on the spot frees the table as well; both happen
+		// or neither does.
+		var result *mongo.InsertOneResult
+		err = inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+			var err error
+			result, err = invoiceCollection.InsertOne(sessionCtx, invoice)
+			if err != nil {
+				return err
+			}
+			if *invoice.Payment_status == "PAID" {
+				if err := closeOrder(sessionCtx, c, invoice.Order_id); err != nil {
+					return err
+				}
+			}
+			auditCreate(sessionCtx, c, "invoices", invoice.Invoice_id, invoice)
+			return nil
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invoice"})
+			rollbackResponse(c, err, "invoice creation")
 			return
 		}
 
+		setETag(c, invoice.Version)
 		c.JSON(http.StatusOK, result)
 	}
 }
@@ -134,11 +175,32 @@ func UpdateInvoice() gin.HandlerFunc {
 		var invoice models.Invoice
 		invoiceID := c.Param("invoice_id")
 
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
 		if err := c.BindJSON(&invoice); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		var existing models.Invoice
+		err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceID}).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the invoice"})
+			return
+		}
+		createdAt := existing.Created_at
+		if err == mongo.ErrNoDocuments {
+			createdAt = time.Now()
+		} else if existing.Version != version {
+			versionMismatch(ctx, c, invoiceCollection, "invoice_id", invoiceID, "invoice")
+			return
+		}
+		if !checkDayOpen(ctx, c, createdAt) {
+			return
+		}
+
 		var updateObj primitive.D
 		if invoice.Payment_method != nil {
 			updateObj = append(updateObj, bson.E{"payment_method", invoice.Payment_method})
@@ -147,29 +209,135 @@ func UpdateInvoice() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{"payment_status", invoice.Payment_status})
 		}
 
+		if invoice.Discount != nil {
+			if existing.Invoice_id == "" {
+				c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+				return
+			}
+			existing.Discount = invoice.Discount
+			if msg := priceInvoice(ctx, &existing); msg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			updateObj = append(updateObj,
+				bson.E{Key: "subtotal", Value: existing.Subtotal},
+				bson.E{Key: "discount", Value: existing.Discount},
+				bson.E{Key: "tax", Value: existing.Tax},
+				bson.E{Key: "total", Value: existing.Total},
+			)
+		}
+
+		if invoice.Payment_status != nil && *invoice.Payment_status == "PAID" && getStringValue(existing.Payment_status) != "PAID" {
+			paymentMethod := existing.Payment_method
+			if invoice.Payment_method != nil {
+				paymentMethod = invoice.Payment_method
+			}
+			drawerSessionId, ok := recordPayment(ctx, c, paymentMethod)
+			if !ok {
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "paid_at", Value: time.Now()}, bson.E{Key: "drawer_session_id", Value: drawerSessionId})
+		}
+
 		invoice.Updated_at = time.Now()
 		updateObj = append(updateObj, bson.E{"updated_at", invoice.Updated_at})
 
-		upsert := true
+		// Only an invoice that does not exist yet is created here; an existing
+		// one is only updated while it is still at the version the client read.
+		upsert := existing.Invoice_id == ""
 		opts := options.UpdateOptions{Upsert: &upsert}
 		filter := bson.M{"invoice_id": invoiceID}
+		if !upsert {
+			filter = versionFilter("invoice_id", invoiceID, version)
+		}
 
-		result, err := invoiceCollection.UpdateOne(
-			ctx,
-			filter,
-			bson.D{{Key: "$set", Value: updateObj}},
-			&opts,
-		)
+		audit := beginAudit(ctx, "invoices", invoiceID)
+		var result *mongo.UpdateResult
+		err = inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+			var err error
+			result, err = invoiceCollection.UpdateOne(
+				sessionCtx,
+				filter,
+				bson.D{{Key: "$set", Value: updateObj}, bumpVersion},
+				&opts,
+			)
+			if err != nil || (result.MatchedCount == 0 && result.UpsertedCount == 0) {
+				return err
+			}
 
+			// A paid invoice frees the table, so close the order it settles
+			// in the same transaction.
+			if invoice.Payment_status != nil && *invoice.Payment_status == "PAID" {
+				var paidInvoice models.Invoice
+				if err := invoiceCollection.FindOne(sessionCtx, bson.M{"invoice_id": invoiceID}).Decode(&paidInvoice); err != nil {
+					return err
+				}
+				if paidInvoice.Order_id != "" {
+					if err := closeOrder(sessionCtx, c, paidInvoice.Order_id); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice update failed"})
+			rollbackResponse(c, err, "invoice update")
+			return
+		}
+		if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+			versionMismatch(ctx, c, invoiceCollection, "invoice_id", invoiceID, "invoice")
 			return
 		}
+		audit.record(ctx, c)
 
+		setETag(c, existing.Version+1)
 		c.JSON(http.StatusOK, result)
 	}
 }
 
+// priceInvoice sets the subtotal, tax and total of invoice from the live items
+// of its order and its discount, or returns why it cannot be priced.
+func priceInvoice(ctx context.Context, invoice *models.Invoice) string {
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": invoice.Order_id, "voided_at": nil})
+	if err != nil {
+		return "error while pricing the order"
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return "error while pricing the order"
+	}
+
+	subtotal := 0.0
+	for _, orderItem := range orderItems {
+		if orderItem.UnitPrice != nil && orderItem.Quantity != nil {
+			subtotal += *orderItem.UnitPrice * float64(*orderItem.Quantity)
+		}
+	}
+	discount := 0.0
+	if invoice.Discount != nil {
+		discount = toFixed(*invoice.Discount, 2)
+	}
+	if discount < 0 || discount > subtotal {
+		return fmt.Sprintf("discount must be between 0 and the subtotal of %.2f", subtotal)
+	}
+
+	invoice.Subtotal = toFixed(subtotal, 2)
+	invoice.Discount = &discount
+	invoice.Tax = toFixed((invoice.Subtotal-discount)*taxRate(), 2)
+	invoice.Total = toFixed(invoice.Subtotal-discount+invoice.Tax, 2)
+	return ""
+}
+
+// taxRate is the sales tax charged on invoices, as a fraction set with
+// TAX_RATE, e.g. 0.08. It is 0 when unset.
+func taxRate() float64 {
+	rate, err := strconv.ParseFloat(os.Getenv("TAX_RATE"), 64)
+	if err != nil || rate < 0 {
+		return 0
+	}
+	return rate
+}
+
 func getStringValue(ptr *string) string {
 	if ptr != nil {
 		return *ptr
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultListLimit = 20
+const maxListLimit = 100
+
+// listQuery describes what a list route lets clients filter and sort on.
+// Filters maps each filterable field, which is also its query parameter, to
+// its kind: "string", "int", "float", "bool" or "date". Comma separated values
+// match any of them; date fields are filtered with <field>_from and
+// <field>_to instead, in RFC3339.
+type listQuery struct {
+	Filters     map[string]string
+	Sorts       []string
+	DefaultSort string
+	Projection  bson.D
+}
+
+// ListPage is the envelope every list route responds with. Pass Next_cursor
+// back as ?cursor= to get the following page; it is null on the last one.
+type ListPage struct {
+	Data        []bson.M `json:"data"`
+	Next_cursor *string  `json:"next_cursor"`
+	Total       int64    `json:"total"`
+}
+
+// listCursor marks where a page ended: the sort value and id of its last
+// document. The sort is kept so a cursor is not reused with another order.
+type listCursor struct {
+	Sort  string             `bson:"s"`
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"i"`
+}
+
+// listDocuments lists a page of the documents of collection matching base and
+// the filters in the query string, using keyset pagination on the requested
+// sort with _id to break ties, so pages stay stable while documents are added.
+// Deleted documents are left out unless an admin asks for them, see
+// includeDeleted. It writes the error response itself when the query is
+// invalid.
+func listDocuments(ctx context.Context, c *gin.Context, collection *mongo.Collection, base interface{}, query listQuery) (ListPage, bool) {
+	limit, ok := listLimit(c)
+	if !ok {
+		return ListPage{}, false
+	}
+
+	sortBy := c.DefaultQuery("sort", query.DefaultSort)
+	field := strings.TrimPrefix(sortBy, "-")
+	direction := 1
+	if strings.HasPrefix(sortBy, "-") {
+		direction = -1
+	}
+	if field != "_id" && !contains(query.Sorts, field) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("sort must be one of %s, optionally prefixed with -", strings.Join(query.Sorts, ", "))})
+		return ListPage{}, false
+	}
+
+	filters, msg := listFilters(c, query.Filters)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return ListPage{}, false
+	}
+	conditions := bson.A{base, filters}
+	include, ok := includeDeleted(ctx, c)
+	if !ok {
+		return ListPage{}, false
+	}
+	if !include {
+		conditions = append(conditions, bson.M{"deleted_at": nil})
+	}
+
+	total, err := collection.CountDocuments(ctx, bson.D{{Key: "$and", Value: conditions}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while counting documents"})
+		return ListPage{}, false
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, ok := decodeListCursor(value)
+		if !ok || cursor.Sort != sortBy {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor is invalid for this sort"})
+			return ListPage{}, false
+		}
+		conditions = append(conditions, afterCursor(field, direction, cursor))
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(limit + 1))
+	if query.Projection != nil {
+		opts.SetProjection(query.Projection)
+	}
+
+	cursor, err := collection.Find(ctx, bson.D{{Key: "$and", Value: conditions}}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while listing documents"})
+		return ListPage{}, false
+	}
+	data := []bson.M{}
+	if err = cursor.All(ctx, &data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return ListPage{}, false
+	}
+
+	page := ListPage{Data: data, Total: total}
+	if len(data) > limit {
+		page.Data = data[:limit]
+		last := page.Data[limit-1]
+		id, _ := last["_id"].(primitive.ObjectID)
+		next := encodeListCursor(listCursor{Sort: sortBy, Value: last[field], ID: id})
+		page.Next_cursor = &next
+	}
+	return page, true
+}
+
+// listLimit reads the page size from the limit query parameter, writing the
+// error response itself when it is out of range.
+func listLimit(c *gin.Context) (int, bool) {
+	value := c.Query("limit")
+	if value == "" {
+		return defaultListLimit, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxListLimit)})
+		return 0, false
+	}
+	return limit, true
+}
+
+// listFilters turns the filter query parameters into a Mongo filter, or
+// returns an error message.
+func listFilters(c *gin.Context, fields map[string]string) (bson.D, string) {
+	filter := bson.D{}
+	for field, kind := range fields {
+		if kind == "date" {
+			dates := bson.D{}
+			for _, bound := range []struct{ suffix, operator string }{{"_from", "$gte"}, {"_to", "$lte"}} {
+				value := c.Query(field + bound.suffix)
+				if value == "" {
+					continue
+				}
+				date, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return nil, fmt.Sprintf("%s%s must be an RFC3339 time", field, bound.suffix)
+				}
+				dates = append(dates, bson.E{Key: bound.operator, Value: date})
+			}
+			if len(dates) > 0 {
+				filter = append(filter, bson.E{Key: field, Value: dates})
+			}
+			continue
+		}
+
+		value := c.Query(field)
+		if value == "" {
+			continue
+		}
+		values := bson.A{}
+		for _, item := range strings.Split(value, ",") {
+			parsed, err := parseListValue(kind, strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Sprintf("%s must be a %s", field, kind)
+			}
+			values = append(values, parsed)
+		}
+		if len(values) == 1 {
+			filter = append(filter, bson.E{Key: field, Value: values[0]})
+		} else {
+			filter = append(filter, bson.E{Key: field, Value: bson.D{{Key: "$in", Value: values}}})
+		}
+	}
+	return filter, ""
+}
+
+func parseListValue(kind, value string) (interface{}, error) {
+	switch kind {
+	case "int":
+		return strconv.Atoi(value)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+// afterCursor matches the documents that come after the cursor in the sort.
+// Missing and null values sort before everything else, and comparison
+// operators never match them, so they need their own clauses.
+func afterCursor(field string, direction int, cursor listCursor) bson.D {
+	operator := "$gt"
+	if direction < 0 {
+		operator = "$lt"
+	}
+	sameValueLaterId := bson.D{{Key: field, Value: cursor.Value}, {Key: "_id", Value: bson.D{{Key: operator, Value: cursor.ID}}}}
+
+	if cursor.Value == nil {
+		if direction > 0 {
+			return bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: field, Value: bson.D{{Key: "$ne", Value: nil}}}},
+				sameValueLaterId,
+			}}}
+		}
+		return sameValueLaterId
+	}
+
+	clauses := bson.A{
+		bson.D{{Key: field, Value: bson.D{{Key: operator, Value: cursor.Value}}}},
+		sameValueLaterId,
+	}
+	if direction < 0 {
+		clauses = append(clauses, bson.D{{Key: field, Value: nil}})
+	}
+	return bson.D{{Key: "$or", Value: clauses}}
+}
+
+func encodeListCursor(cursor listCursor) string {
+	raw, err := bson.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeListCursor(value string) (listCursor, bool) {
+	var cursor listCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, false
+	}
+	if err = bson.Unmarshal(raw, &cursor); err != nil {
+		return cursor, false
+	}
+	return cursor, true
+}
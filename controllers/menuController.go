@@ -2,9 +2,9 @@ package controllers
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net/http"
-	"strconv"
+	"sort"
 	"time"
 
 	"golang-restrogo/database"
@@ -25,59 +25,15 @@ func GetMenus() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Add pagination parameters
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
-
-		page, err := strconv.Atoi(c.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
-		}
-
-		startIndex := (page - 1) * recordPerPage
-
-		// MongoDB query with pagination
-		matchStage := bson.D{{Key: "$match", Value: bson.D{}}}
-		groupStage := bson.D{
-			{Key: "$group", Value: bson.D{
-				{Key: "_id", Value: nil},
-				{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
-				{Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
-			}},
-		}
-		projectStage := bson.D{
-			{Key: "$project", Value: bson.D{
-				{Key: "_id", Value: 0},
-				{Key: "total_count", Value: 1},
-				{Key: "menu_items", Value: bson.D{
-					{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage}},
-				}},
-			}},
-		}
-
-		cursor, err := menuCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage,
+		page, ok := listDocuments(ctx, c, menuCollection, bson.D{}, listQuery{
+			Filters:     map[string]string{"category": "string"},
+			Sorts:       []string{"name", "category", "category_order", "start_date", "created_at", "updated_at"},
+			DefaultSort: "-created_at",
 		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing menu items"})
+		if !ok {
 			return
 		}
-
-		var allMenus []bson.M
-		if err = cursor.All(ctx, &allMenus); err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		if len(allMenus) == 0 {
-			c.JSON(http.StatusOK, gin.H{"message": "No menus found", "data": []interface{}{}})
-			return
-		}
-
-		c.JSON(http.StatusOK, allMenus[0])
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -91,13 +47,18 @@ func GetMenu() gin.HandlerFunc {
 
 		// menuId in the database is likely stored as a string (menu_id field), not ObjectId.
 		// We will search by menu_id (string hex) instead of _id (ObjectId).
-		err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu)
+		filter := bson.M{"menu_id": menuId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := menuCollection.FindOne(ctx, filter).Decode(&menu)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "error occurred while fetching the menu",
 			})
 			return
 		}
+		setETag(c, menu.Version)
 		c.JSON(http.StatusOK, menu)
 	}
 }
@@ -120,18 +81,31 @@ func CreateMenu() gin.HandlerFunc {
 			return
 		}
 
+		if msg := checkMenuSchedule(menu); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
 		now := time.Now()
 		menu.Created_at = &now
 		menu.Updated_at = menu.Created_at
 		menu.ID = primitive.NewObjectID()
 		menu.Menu_id = menu.ID.Hex()
+		menu.Version = 1
 
 		result, insertErr := menuCollection.InsertOne(ctx, menu)
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": "sku is already used by another menu"})
+			return
+		}
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu item was not created"})
 			return
 		}
+		publicCache.invalidate()
+		auditCreate(ctx, c, "menus", menu.Menu_id, menu)
 
+		setETag(c, menu.Version)
 		c.JSON(http.StatusOK, result)
 	}
 }
@@ -144,11 +118,37 @@ func UpdateMenu() gin.HandlerFunc {
 		menuId := c.Param("menu_id")
 		var menu models.Menu
 
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
 		if err := c.BindJSON(&menu); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		// Check the schedule as it will be after the update.
+		var existing models.Menu
+		if err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&existing); err == nil {
+			if menu.Start_Date != nil {
+				existing.Start_Date = menu.Start_Date
+			}
+			if menu.End_Date != nil {
+				existing.End_Date = menu.End_Date
+			}
+			if menu.Dayparts != nil {
+				if validationErr := validate.Var(menu.Dayparts, "dive"); validationErr != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+					return
+				}
+				existing.Dayparts = menu.Dayparts
+			}
+			if msg := checkMenuSchedule(existing); msg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+		}
+
 		var updateObj bson.D
 
 		if menu.Name != "" {
@@ -163,31 +163,364 @@ func UpdateMenu() gin.HandlerFunc {
 		if menu.End_Date != nil {
 			updateObj = append(updateObj, bson.E{Key: "end_date", Value: menu.End_Date})
 		}
+		if menu.Dayparts != nil {
+			updateObj = append(updateObj, bson.E{Key: "dayparts", Value: menu.Dayparts})
+		}
+		if menu.Category_order != nil {
+			updateObj = append(updateObj, bson.E{Key: "category_order", Value: menu.Category_order})
+		}
+		if menu.Sku != nil {
+			if validationErr := validate.Var(*menu.Sku, "max=64"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sku must be at most 64 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "sku", Value: *menu.Sku})
+		}
 
 		now := time.Now()
 		menu.Updated_at = &now
 		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: menu.Updated_at})
 
 		// Query by menu_id string field, NOT _id (ObjectId)
-		filter := bson.M{"menu_id": menuId}
-		update := bson.D{{Key: "$set", Value: updateObj}}
+		filter := versionFilter("menu_id", menuId, version)
+		update := bson.D{{Key: "$set", Value: updateObj}, bumpVersion}
 
+		audit := beginAudit(ctx, "menus", menuId)
 		result, err := menuCollection.UpdateOne(ctx, filter, update)
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "sku is already used by another menu"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu update failed"})
 			return
 		}
+		if result.MatchedCount == 0 {
+			versionMismatch(ctx, c, menuCollection, "menu_id", menuId, "menu")
+			return
+		}
+		publicCache.invalidate()
+		audit.record(ctx, c)
 
-		// Return the updated document only if matched
 		var updatedMenu models.Menu
-		if result.MatchedCount == 1 {
-			err := menuCollection.FindOne(ctx, filter).Decode(&updatedMenu)
+		err = menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&updatedMenu)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu update failed"})
+			return
+		}
+
+		setETag(c, updatedMenu.Version)
+		c.JSON(http.StatusOK, updatedMenu)
+	}
+}
+
+// GetMenuFoods lists the foods on a menu together with whether each can be
+// ordered right now.
+func GetMenuFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+
+		cursor, err := foodCollection.Find(ctx, bson.M{"menu_id": menuId, "deleted_at": nil})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing menu foods"})
+			return
+		}
+
+		var foods []models.Food
+		if err = cursor.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		availability, err := foodAvailability(ctx, foods)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking food availability"})
+			return
+		}
+
+		views := []FoodView{}
+		unavailableCount := 0
+		for _, food := range foods {
+			status := availability[food.Food_id]
+			if !status.Available {
+				unavailableCount++
+			}
+			views = append(views, FoodView{Food: food, FoodAvailability: status})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"menu_id": menuId, "foods": views, "unavailable_count": unavailableCount})
+	}
+}
+
+// GetActiveMenus returns the menus being served at the time given by ?at=
+// (RFC3339), or right now.
+func GetActiveMenus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		at := time.Now()
+		if v := c.Query("at"); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "menu update failed"})
+				c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC3339 timestamp"})
 				return
 			}
+			at = parsed
 		}
 
-		c.JSON(http.StatusOK, updatedMenu)
+		menus, err := activeMenus(ctx, at)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing active menus"})
+			return
+		}
+
+		c.JSON(http.StatusOK, menus)
+	}
+}
+
+type MenuCategoryView struct {
+	Name  string     `json:"name"`
+	Foods []FoodView `json:"foods"`
+}
+
+type FullMenuView struct {
+	models.Menu
+	Categories []MenuCategoryView `json:"categories"`
+}
+
+// GetFullMenu returns a menu with its foods grouped by category, so a tablet
+// can render it from a single request.
+func GetFullMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		view, err := fullMenu(ctx, c.Param("menu_id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "menu not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while fetching the menu"})
+			return
+		}
+
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// fullMenu loads a menu and joins its foods, sorted by sort_order then name
+// and grouped by category. Categories follow the menu's category_order, with
+// any others after them alphabetically.
+func fullMenu(ctx context.Context, menuId string) (FullMenuView, error) {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "menu_id", Value: menuId}, {Key: "deleted_at", Value: nil}}}}
+	lookupStage := bson.D{
+		{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "food"},
+			{Key: "let", Value: bson.D{{Key: "menu_id", Value: "$menu_id"}}},
+			{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$menu_id", "$$menu_id"}}}},
+					{Key: "deleted_at", Value: nil},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "sort_order", Value: 1}, {Key: "name", Value: 1}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$category", "Other"}}}},
+					{Key: "foods", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
+				}}},
+			}},
+			{Key: "as", Value: "categories"},
+		}},
+	}
+
+	cursor, err := menuCollection.Aggregate(ctx, mongo.Pipeline{matchStage, lookupStage})
+	if err != nil {
+		return FullMenuView{}, err
+	}
+
+	var results []struct {
+		models.Menu `bson:",inline"`
+		Categories  []struct {
+			Name  string        `bson:"_id"`
+			Foods []models.Food `bson:"foods"`
+		} `bson:"categories"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return FullMenuView{}, err
+	}
+	if len(results) == 0 {
+		return FullMenuView{}, mongo.ErrNoDocuments
+	}
+	result := results[0]
+
+	foods := []models.Food{}
+	for _, category := range result.Categories {
+		foods = append(foods, category.Foods...)
+	}
+	availability, err := foodAvailability(ctx, foods)
+	if err != nil {
+		return FullMenuView{}, err
+	}
+
+	view := FullMenuView{Menu: result.Menu, Categories: []MenuCategoryView{}}
+	for _, category := range result.Categories {
+		categoryView := MenuCategoryView{Name: category.Name, Foods: []FoodView{}}
+		for _, food := range category.Foods {
+			categoryView.Foods = append(categoryView.Foods, FoodView{Food: food, FoodAvailability: availability[food.Food_id]})
+		}
+		view.Categories = append(view.Categories, categoryView)
+	}
+
+	position := map[string]int{}
+	for i, name := range result.Category_order {
+		position[name] = i
+	}
+	sort.SliceStable(view.Categories, func(i, j int) bool {
+		pi, iOrdered := position[view.Categories[i].Name]
+		pj, jOrdered := position[view.Categories[j].Name]
+		if iOrdered && jOrdered {
+			return pi < pj
+		}
+		if iOrdered != jOrdered {
+			return iOrdered
+		}
+		return view.Categories[i].Name < view.Categories[j].Name
+	})
+
+	return view, nil
+}
+
+var weekdays = map[time.Weekday]string{
+	time.Monday:    "MON",
+	time.Tuesday:   "TUE",
+	time.Wednesday: "WED",
+	time.Thursday:  "THU",
+	time.Friday:    "FRI",
+	time.Saturday:  "SAT",
+	time.Sunday:    "SUN",
+}
+
+// checkMenuSchedule returns an error message when the menu's date range or
+// dayparts don't make sense, or an empty string when they do.
+func checkMenuSchedule(menu models.Menu) string {
+	if menu.Start_Date != nil && menu.End_Date != nil && !menu.End_Date.After(*menu.Start_Date) {
+		return "end_date must be after start_date"
+	}
+
+	for _, daypart := range menu.Dayparts {
+		start, err := time.Parse("15:04", daypart.Start_time)
+		if err != nil || len(daypart.Start_time) != 5 {
+			return "daypart start_time must be formatted as HH:MM"
+		}
+		end, err := time.Parse("15:04", daypart.End_time)
+		if err != nil || len(daypart.End_time) != 5 {
+			return "daypart end_time must be formatted as HH:MM"
+		}
+		if !end.After(start) {
+			return "daypart end_time must be after start_time"
+		}
+	}
+	return ""
+}
+
+// isMenuActive reports whether a menu is served at the given time: inside its
+// start/end dates and, if it has dayparts, inside one of them.
+func isMenuActive(menu models.Menu, at time.Time) bool {
+	if menu.Start_Date != nil && at.Before(*menu.Start_Date) {
+		return false
+	}
+	if menu.End_Date != nil && !at.Before(*menu.End_Date) {
+		return false
+	}
+	if len(menu.Dayparts) == 0 {
+		return true
+	}
+
+	local := at.In(time.Local)
+	day := weekdays[local.Weekday()]
+	clock := local.Format("15:04")
+	for _, daypart := range menu.Dayparts {
+		for _, d := range daypart.Days {
+			// HH:MM strings compare in time order.
+			if d == day && clock >= daypart.Start_time && clock < daypart.End_time {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func activeMenus(ctx context.Context, at time.Time) ([]models.Menu, error) {
+	cursor, err := menuCollection.Find(ctx, bson.M{"deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	var menus []models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, err
+	}
+
+	active := []models.Menu{}
+	for _, menu := range menus {
+		if isMenuActive(menu, at) {
+			active = append(active, menu)
+		}
+	}
+	return active, nil
+}
+
+// offMenuFoods returns the foods among foodIds whose menu is not being served
+// at the given time.
+func offMenuFoods(ctx context.Context, foodIds []string, at time.Time) ([]UnavailableFood, error) {
+	cursor, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var foods []models.Food
+	if err = cursor.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+
+	menuIds := []string{}
+	for _, food := range foods {
+		if food.Menu_id != nil {
+			menuIds = append(menuIds, *food.Menu_id)
+		}
+	}
+
+	cursor, err = menuCollection.Find(ctx, bson.M{"menu_id": bson.M{"$in": menuIds}})
+	if err != nil {
+		return nil, err
+	}
+	var menus []models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, err
+	}
+
+	menusById := map[string]models.Menu{}
+	for _, menu := range menus {
+		menusById[menu.Menu_id] = menu
+	}
+
+	offMenu := []UnavailableFood{}
+	for _, food := range foods {
+		if food.Menu_id == nil {
+			continue
+		}
+		menu, found := menusById[*food.Menu_id]
+		if !found {
+			offMenu = append(offMenu, UnavailableFood{Food_id: food.Food_id, Name: getStringValue(food.Name), Reason: "menu not found"})
+			continue
+		}
+		if !isMenuActive(menu, at) {
+			reason := fmt.Sprintf("%s menu is not being served now", menu.Name)
+			offMenu = append(offMenu, UnavailableFood{Food_id: food.Food_id, Name: getStringValue(food.Name), Reason: reason})
+		}
 	}
+	return offMenu, nil
 }
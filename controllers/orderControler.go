@@ -12,6 +12,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var orderCollection = database.OpenCollection(database.Client, "order")
@@ -21,19 +22,29 @@ func GetOrders() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		cursor, err := orderCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while listing orders"})
-			return
+		filter := bson.M{}
+		if c.Query("mine") == "true" {
+			if currentUserID(c) == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "mine=true requires a logged-in user"})
+				return
+			}
+			tableIds, err := mySectionTableIDs(ctx, c)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error while resolving your section"})
+				return
+			}
+			filter["table_id"] = bson.M{"$in": tableIds}
 		}
 
-		var orders []bson.M
-		if err = cursor.All(ctx, &orders); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		page, ok := listDocuments(ctx, c, orderCollection, filter, listQuery{
+			Filters:     map[string]string{"table_id": "string", "status": "string", "source": "string", "created_at": "date"},
+			Sorts:       []string{"order_date", "created_at", "updated_at", "closed_at"},
+			DefaultSort: "-created_at",
+		})
+		if !ok {
 			return
 		}
-
-		c.JSON(http.StatusOK, orders)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -45,7 +56,11 @@ func GetOrder() gin.HandlerFunc {
 		orderId := c.Param("order_id")
 		var order models.Order
 
-		err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+		filter := bson.M{"order_id": orderId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := orderCollection.FindOne(ctx, filter).Decode(&order)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
@@ -55,6 +70,7 @@ func GetOrder() gin.HandlerFunc {
 			return
 		}
 
+		setETag(c, order.Version)
 		c.JSON(http.StatusOK, order)
 	}
 }
@@ -92,9 +108,15 @@ func CreateOrder() gin.HandlerFunc {
 		now := time.Now()
 		order.ID = primitive.NewObjectID()
 		order.Order_id = order.ID.Hex()
+		order.Version = 1
 		order.Created_at = now
 		order.Updated_at = now
 		order.Ordered_at = now
+		status := "OPEN"
+		order.Status = &status
+		if userId := currentUserID(c); userId != "" {
+			order.Waiter_id = &userId
+		}
 		order.Price = toFixed(totalPrice, 2)
 
 		_, insertErr := orderCollection.InsertOne(ctx, order)
@@ -102,7 +124,9 @@ func CreateOrder() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "order could not be created"})
 			return
 		}
+		auditCreate(ctx, c, "orders", order.Order_id, order)
 
+		setETag(c, order.Version)
 		c.JSON(http.StatusOK, order)
 	}
 }
@@ -115,6 +139,10 @@ func UpdateOrder() gin.HandlerFunc {
 		orderId := c.Param("order_id")
 		var order models.Order
 
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
 		if err := c.BindJSON(&order); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -128,7 +156,7 @@ func UpdateOrder() gin.HandlerFunc {
 			var totalPrice float64
 			for _, foodID := range order.Items {
 				var food models.Food
-				err := foodCollection.FindOne(ctx, bson.M{"food_id": foodID}).Decode(&food)
+				err := foodCollection.FindOne(ctx, bson.M{"food_id": foodID, "deleted_at": nil}).Decode(&food)
 				if err != nil {
 					msg := fmt.Sprintf("food item %s not found", foodID)
 					c.JSON(http.StatusBadRequest, gin.H{"error": msg})
@@ -142,38 +170,215 @@ func UpdateOrder() gin.HandlerFunc {
 
 		update = append(update, bson.E{Key: "updated_at", Value: time.Now()})
 
-		filter := bson.M{"order_id": orderId}
-		result, err := orderCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}})
+		filter := versionFilter("order_id", orderId, version)
+		audit := beginAudit(ctx, "orders", orderId)
+		result, err := orderCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}, bumpVersion})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "order update failed"})
 			return
 		}
+		audit.record(ctx, c)
 
 		if result.MatchedCount == 1 {
 			var updatedOrder models.Order
-			err := orderCollection.FindOne(ctx, filter).Decode(&updatedOrder)
+			err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&updatedOrder)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated order"})
 				return
 			}
+			setETag(c, updatedOrder.Version)
 			c.JSON(http.StatusOK, updatedOrder)
 			return
 		}
 
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		versionMismatch(ctx, c, orderCollection, "order_id", orderId, "order")
 	}
 }
 
+// ConfirmOrder accepts an order a guest placed from the table QR code. It
+// opens the order, which sends it to the kitchen, and takes its items out of
+// stock, all in one transaction.
+func ConfirmOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+		now := time.Now()
+		update := bson.D{
+			{Key: "status", Value: "OPEN"},
+			{Key: "reviewed_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}
+		if userId := currentUserID(c); userId != "" {
+			update = append(update, bson.E{Key: "reviewed_by", Value: userId}, bson.E{Key: "waiter_id", Value: userId})
+		}
+
+		var order models.Order
+		err := inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+			var err error
+			order, err = resolvePendingOrder(sessionCtx, c, orderId, update)
+			if err != nil {
+				return err
+			}
 
-func OrderItemOrderCreator(order models.Order) string {
-	order.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
-	order.UPdated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+			cursor, err := orderItemCollection.Find(sessionCtx, bson.M{"order_id": orderId, "voided_at": nil})
+			if err != nil {
+				return err
+			}
+			var orderItems []models.OrderItem
+			if err = cursor.All(sessionCtx, &orderItems); err != nil {
+				return err
+			}
+			for _, orderItem := range orderItems {
+				if err := deductOrderItemStock(sessionCtx, orderItem); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			rollbackResponse(c, err, "order confirmation")
+			return
+		}
 
-	order.ID = primitive.NewObjectID()
-	order.Order_id = order.ID.Hex()
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// RejectOrder turns down an order a guest placed from the table QR code and
+// voids its items, in one transaction.
+func RejectOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+		now := time.Now()
+		update := bson.D{
+			{Key: "status", Value: "REJECTED"},
+			{Key: "closed_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}
+		if userId := currentUserID(c); userId != "" {
+			update = append(update, bson.E{Key: "reviewed_by", Value: userId})
+		}
+
+		var order models.Order
+		err := inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+			var err error
+			order, err = resolvePendingOrder(sessionCtx, c, orderId, update)
+			if err != nil {
+				return err
+			}
+
+			audits, err := beginOrderItemAudits(sessionCtx, orderId)
+			if err != nil {
+				return err
+			}
+			_, err = orderItemCollection.UpdateMany(sessionCtx,
+				bson.M{"order_id": orderId, "voided_at": nil},
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "voided_at", Value: now},
+					{Key: "updated_at", Value: now},
+				}}, bumpVersion},
+			)
+			if err != nil {
+				return err
+			}
+			for _, audit := range audits {
+				audit.record(sessionCtx, c)
+			}
+			return nil
+		})
+		if err != nil {
+			rollbackResponse(c, err, "order rejection")
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
 
-	orderCollection.InsertOne(ctx,order)
-	defer cancel
+// resolvePendingOrder applies update to an order still waiting for
+// confirmation and returns it. An order that does not exist or was already
+// handled aborts the transaction it runs in.
+func resolvePendingOrder(sessionCtx mongo.SessionContext, c *gin.Context, orderId string, update bson.D) (models.Order, error) {
+	var order models.Order
+	audit := beginAudit(sessionCtx, "orders", orderId)
+	err := orderCollection.FindOneAndUpdate(sessionCtx,
+		bson.M{"order_id": orderId, "status": "PENDING_CONFIRMATION"},
+		bson.D{{Key: "$set", Value: update}, bumpVersion},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&order)
+	if err == nil {
+		audit.record(sessionCtx, c)
+		return order, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return order, err
+	}
 
-	return order.Order_id
-}
\ No newline at end of file
+	count, err := orderCollection.CountDocuments(sessionCtx, bson.M{"order_id": orderId})
+	if err != nil {
+		return order, err
+	}
+	if count == 0 {
+		return order, &abortError{http.StatusNotFound, "order not found"}
+	}
+	return order, &abortError{http.StatusConflict, "order is not waiting for confirmation"}
+}
+
+// beginOrderItemAudits starts auditing every live item of an order, before
+// they are all updated at once.
+func beginOrderItemAudits(ctx context.Context, orderId string) ([]*auditChange, error) {
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": orderId, "voided_at": nil})
+	if err != nil {
+		return nil, err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return nil, err
+	}
+
+	audits := []*auditChange{}
+	for _, orderItem := range orderItems {
+		audits = append(audits, beginAudit(ctx, "orderItems", orderItem.OrderItemID))
+	}
+	return audits, nil
+}
+
+// closeOrder marks an order as finished so its table counts as free again.
+func closeOrder(ctx context.Context, c *gin.Context, orderId string) error {
+	now := time.Now()
+	audit := beginAudit(ctx, "orders", orderId)
+	_, err := orderCollection.UpdateOne(ctx,
+		bson.M{"order_id": orderId, "status": "OPEN"},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: "CLOSED"},
+			{Key: "closed_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}}, bumpVersion},
+	)
+	if err != nil {
+		return err
+	}
+	audit.record(ctx, c)
+	return nil
+}
+
+// OrderItemOrderCreator fills in a new OPEN order for the items sent to
+// CreateOrderItem. It does not write the order: insertOrderWithItems writes it
+// together with its items.
+func OrderItemOrderCreator(order models.Order) models.Order {
+	now := time.Now()
+	order.ID = primitive.NewObjectID()
+	order.Order_id = order.ID.Hex()
+	order.Version = 1
+	status := "OPEN"
+	order.Status = &status
+	order.Order_Date = now
+	order.Created_at = now
+	order.Updated_at = now
+	return order
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -20,7 +21,13 @@ var validate = validator.New()
 
 type OrderItemPack struct {
 	Table_id    *string            `json:"table_id" validate:"required"`
-	Order_items []models.OrderItem `json:"order_items" validate:"required,dive"`
+	Order_items []models.OrderItem `json:"order_items" validate:"required,min=1,dive"`
+}
+
+var orderItemListQuery = listQuery{
+	Filters:     map[string]string{"order_id": "string", "food_id": "string", "combo_id": "string"},
+	Sorts:       []string{"created_at", "updated_at", "unit_price", "quantity"},
+	DefaultSort: "created_at",
 }
 
 func GetOrderItems() gin.HandlerFunc {
@@ -28,29 +35,24 @@ func GetOrderItems() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		result, err := orderItemCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing order items"})
-			return
-		}
-		var allOrderItems []bson.M
-		if err = result.All(ctx, &allOrderItems); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding order items"})
+		page, ok := listDocuments(ctx, c, orderItemCollection, bson.M{}, orderItemListQuery)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, allOrderItems)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
 func GetOrderItemsByOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		orderID := c.Param("order_id")
-		allOrderItems, err := ItemsByOrder(orderID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, orderItemCollection, bson.M{"order_id": c.Param("order_id")}, orderItemListQuery)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, allOrderItems)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -72,77 +74,131 @@ func ItemsByOrder(id string) (orderItems []primitive.M, err error) {
 func GetOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		orderItemID := c.Param("order_item_id")
-		objID, _ := primitive.ObjectIDFromHex(orderItemID)
+		orderItemID := c.Param("orderItem_id")
 
 		var orderItem models.OrderItem
 
-		err := orderItemCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&orderItem)
-		defer cancel()
+		filter := bson.M{"order_item_id": orderItemID}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := orderItemCollection.FindOne(ctx, filter).Decode(&orderItem)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order item not found"})
 			return
 		}
+		setETag(c, orderItem.Version)
 		c.JSON(http.StatusOK, orderItem)
 	}
 }
 
+// CreateOrderItem opens an order for a table with its first items. The order,
+// its items and the stock they use are written in one transaction, so an
+// error part way through leaves no order or items behind.
 func CreateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		var OrderItemPack OrderItemPack
-		var order models.Order
 
 		if err := c.BindJSON(&OrderItemPack); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-
-		orderItemsToBeInserted := []interface{}{}
+		var order models.Order
 		order.Table_id = OrderItemPack.Table_id
-		order_id := OrderItemOrderCreator(order)
+		if userId := currentUserID(c); userId != "" {
+			order.Waiter_id = &userId
+		}
+		order = OrderItemOrderCreator(order)
+		for i := range OrderItemPack.Order_items {
+			OrderItemPack.Order_items[i].OrderID = order.Order_id
+		}
 
-		for _, orderItem := range OrderItemPack.Order_items {
-			orderItem.OrderID = order_id
+		// Everything is checked before anything is written.
+		if validationErr := validate.Struct(OrderItemPack); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
 
-			validationErr := validate.Struct(orderItem)
+		count, err := tableCollection.CountDocuments(ctx, bson.M{"table_id": order.Table_id, "deleted_at": nil})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the table"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "table was not found"})
+			return
+		}
 
-			if validationErr != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr})
-				return
-			}
+		if !checkOrderItems(ctx, c, OrderItemPack.Order_items) {
+			return
+		}
 
+		now := time.Now()
+		for i := range OrderItemPack.Order_items {
+			orderItem := &OrderItemPack.Order_items[i]
 			orderItem.ID = primitive.NewObjectID()
-			orderItem.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-			orderItem.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 			orderItem.OrderItemID = orderItem.ID.Hex()
-			var num = toFixed(*orderItem.UnitPrice, 2)
-			orderItem.UnitPrice = &num
-			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
-
+			orderItem.Version = 1
+			orderItem.CreatedAt = now
+			orderItem.UpdatedAt = now
 		}
 
-		insertedOrderItems, err := orderItemCollection.InsertMany(ctx, orderItemsToBeInserted)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order item creation failed"})
+		if err := insertOrderWithItems(ctx, c, order, OrderItemPack.Order_items); err != nil {
+			rollbackResponse(c, err, "order creation")
 			return
 		}
-		defer cancel()
 
-		c.JSON(http.StatusCreated, insertedOrderItems)
+		c.JSON(http.StatusCreated, gin.H{"order": order, "order_items": OrderItemPack.Order_items})
 	}
 }
 
+// insertOrderWithItems writes a new order and its items in one transaction.
+// Items of an OPEN order go to the kitchen, so their stock is taken in the
+// same transaction; orders waiting for confirmation take it when confirmed.
+func insertOrderWithItems(ctx context.Context, c *gin.Context, order models.Order, orderItems []models.OrderItem) error {
+	return inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+		if _, err := orderCollection.InsertOne(sessionCtx, order); err != nil {
+			return err
+		}
+
+		documents := []interface{}{}
+		for _, orderItem := range orderItems {
+			documents = append(documents, orderItem)
+		}
+		if _, err := orderItemCollection.InsertMany(sessionCtx, documents); err != nil {
+			return err
+		}
+
+		if getStringValue(order.Status) == "OPEN" {
+			for _, orderItem := range orderItems {
+				if err := deductOrderItemStock(sessionCtx, orderItem); err != nil {
+					return err
+				}
+			}
+		}
+
+		auditCreate(sessionCtx, c, "orders", order.Order_id, order)
+		for _, orderItem := range orderItems {
+			auditCreate(sessionCtx, c, "orderItems", orderItem.OrderItemID, orderItem)
+		}
+		return nil
+	})
+}
+
 func UpdateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		objID, _ := primitive.ObjectIDFromHex(id)
+		orderItemID := c.Param("orderItem_id")
 
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
 		var updateData models.OrderItem
 		if err := c.ShouldBindJSON(&updateData); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -154,26 +210,438 @@ func UpdateOrderItem() gin.HandlerFunc {
 			return
 		}
 
-		update := bson.M{
-			"$set": bson.M{
-				"quantity":      updateData.Quantity,
-				"unit_price":    updateData.UnitPrice,
-				"updated_at":    time.Now(),
-				"food_id":       updateData.FoodID,
-				"order_item_id": updateData.OrderItemID,
-				"order_id":      updateData.OrderID,
-			},
-		}
-
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		_, err := orderItemCollection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+		var existing models.OrderItem
+		if err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemID}).Decode(&existing); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order item not found"})
+			return
+		}
+
+		for _, orderID := range []string{existing.OrderID, updateData.OrderID} {
+			if !checkOrderNotInvoiced(ctx, c, orderID) {
+				return
+			}
+		}
+		oldHoldsStock, err := orderHoldsStock(ctx, existing.OrderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching the order"})
+			return
+		}
+		newHoldsStock, err := orderHoldsStock(ctx, updateData.OrderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching the order"})
+			return
+		}
+
+		msg, err := resolveOrderItem(ctx, &updateData)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error pricing order item"})
+			return
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		update := bson.D{
+			{Key: "$set", Value: bson.M{
+				"quantity":   updateData.Quantity,
+				"unit_price": updateData.UnitPrice,
+				"modifiers":  updateData.Modifiers,
+				"updated_at": time.Now(),
+				"food_id":    updateData.FoodID,
+				"combo_id":   updateData.ComboID,
+				"components": updateData.Components,
+				"order_id":   updateData.OrderID,
+			}},
+			bumpVersion,
+		}
+
+		audit := beginAudit(ctx, "orderItems", orderItemID)
+		result, err := orderItemCollection.UpdateOne(ctx, versionFilter("order_item_id", orderItemID, version), update)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order item update failed"})
 			return
 		}
+		if result.MatchedCount == 0 {
+			versionMismatch(ctx, c, orderItemCollection, "order_item_id", orderItemID, "order item")
+			return
+		}
+		audit.record(ctx, c)
 
+		// Swap the stock used by the old food and quantity for the new ones.
+		if existing.VoidedAt == nil && oldHoldsStock {
+			if err := restoreOrderItemStock(ctx, existing); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Order item was updated but stock could not be adjusted"})
+				return
+			}
+		}
+		if existing.VoidedAt == nil && newHoldsStock {
+			if err := deductOrderItemStock(ctx, updateData); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Order item was updated but stock could not be adjusted"})
+				return
+			}
+		}
+
+		setETag(c, existing.Version+1)
 		c.JSON(http.StatusOK, gin.H{"message": "Order item updated successfully"})
 	}
 }
+
+// VoidOrderItem takes an item off the order and puts its ingredients back in
+// stock if the order had taken them. Items of an invoiced order cannot be
+// voided.
+func VoidOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderItemID := c.Param("orderItem_id")
+		var orderItem models.OrderItem
+
+		err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemID}).Decode(&orderItem)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order item not found"})
+			return
+		}
+		if !checkOrderNotInvoiced(ctx, c, orderItem.OrderID) {
+			return
+		}
+		holdsStock, err := orderHoldsStock(ctx, orderItem.OrderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching the order"})
+			return
+		}
+
+		now := time.Now()
+		audit := beginAudit(ctx, "orderItems", orderItemID)
+		result, err := orderItemCollection.UpdateOne(ctx,
+			bson.M{"order_item_id": orderItemID, "voided_at": nil},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "voided_at", Value: now},
+				{Key: "updated_at", Value: now},
+			}}, bumpVersion},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order item void failed"})
+			return
+		}
+		if result.ModifiedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order item is already voided"})
+			return
+		}
+		audit.record(ctx, c)
+
+		if holdsStock {
+			if err := restoreOrderItemStock(ctx, orderItem); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Order item was voided but stock could not be restored"})
+				return
+			}
+		}
+
+		orderItem.VoidedAt = &now
+		orderItem.UpdatedAt = now
+		c.JSON(http.StatusOK, orderItem)
+	}
+}
+
+// orderHoldsStock reports whether the items of an order have been taken out of
+// stock. Only OPEN orders have: a guest order takes its stock when a waiter
+// confirms it, and a rejected one never does.
+func orderHoldsStock(ctx context.Context, orderID string) (bool, error) {
+	count, err := orderCollection.CountDocuments(ctx, bson.M{"order_id": orderID, "status": "OPEN"})
+	return count > 0, err
+}
+
+// checkOrderNotInvoiced reports whether the items of an order can still
+// change, writing the error response itself when the order has an invoice,
+// whose totals would otherwise no longer match its items.
+func checkOrderNotInvoiced(ctx context.Context, c *gin.Context, orderID string) bool {
+	count, err := liveCount(ctx, invoiceCollection, bson.M{"order_id": orderID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking the order's invoice"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order has an invoice; delete it while it is pending to change the order's items"})
+		return false
+	}
+	return true
+}
+
+type KitchenTicketLine struct {
+	Order_item_id string   `json:"order_item_id"`
+	Food_id       string   `json:"food_id"`
+	Name          string   `json:"name"`
+	Quantity      int      `json:"quantity"`
+	Modifiers     []string `json:"modifiers"`
+	Combo         string   `json:"combo,omitempty"`
+	Slot          string   `json:"slot,omitempty"`
+	Allergens     []string `json:"allergens"`
+	Allergen_note string   `json:"allergen_note,omitempty"`
+}
+
+// GetKitchenTickets expands the live items of an order into what the kitchen
+// has to prepare: one line per food, with combos broken into their components.
+func GetKitchenTickets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderID := c.Param("order_id")
+
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&order); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if order.Status != nil && *order.Status == "PENDING_CONFIRMATION" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order is waiting for a waiter to confirm it"})
+			return
+		}
+
+		cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": orderID, "voided_at": nil})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing order items"})
+			return
+		}
+		var orderItems []models.OrderItem
+		if err = cursor.All(ctx, &orderItems); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding order items"})
+			return
+		}
+
+		lines := []KitchenTicketLine{}
+		for _, orderItem := range orderItems {
+			quantity := 0
+			if orderItem.Quantity != nil {
+				quantity = *orderItem.Quantity
+			}
+
+			if orderItem.ComboID == nil {
+				var food models.Food
+				if err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.FoodID}).Decode(&food); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching food for order item"})
+					return
+				}
+				modifiers := []string{}
+				for _, modifier := range orderItem.Modifiers {
+					modifiers = append(modifiers, modifier.Name)
+				}
+				lines = append(lines, KitchenTicketLine{
+					Order_item_id: orderItem.OrderItemID,
+					Food_id:       food.Food_id,
+					Name:          getStringValue(food.Name),
+					Quantity:      quantity,
+					Modifiers:     modifiers,
+					Allergens:     nonNilStrings(food.Allergens),
+					Allergen_note: allergenNote(food.Allergens),
+				})
+				continue
+			}
+
+			var combo models.Combo
+			if err := comboCollection.FindOne(ctx, bson.M{"combo_id": orderItem.ComboID}).Decode(&combo); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching combo for order item"})
+				return
+			}
+			slotNames := map[string]string{}
+			for _, slot := range combo.Slots {
+				slotNames[slot.Slot_id] = slot.Name
+			}
+			for _, component := range orderItem.Components {
+				var food models.Food
+				if err := foodCollection.FindOne(ctx, bson.M{"food_id": component.FoodID}).Decode(&food); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching food for order item"})
+					return
+				}
+				lines = append(lines, KitchenTicketLine{
+					Order_item_id: orderItem.OrderItemID,
+					Food_id:       component.FoodID,
+					Name:          component.Name,
+					Quantity:      quantity,
+					Modifiers:     []string{},
+					Combo:         combo.Name,
+					Slot:          slotNames[component.SlotID],
+					Allergens:     nonNilStrings(food.Allergens),
+					Allergen_note: allergenNote(food.Allergens),
+				})
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"order_id": orderID, "lines": lines})
+	}
+}
+
+// checkOrderItems prices the items of a new order and makes sure every food
+// they use can be served now, writing the error response itself when not.
+func checkOrderItems(ctx context.Context, c *gin.Context, orderItems []models.OrderItem) bool {
+	foodIds := []string{}
+	for i := range orderItems {
+		msg, err := resolveOrderItem(ctx, &orderItems[i])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error pricing order items"})
+			return false
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return false
+		}
+		foodIds = append(foodIds, orderItemFoodIDs(orderItems[i])...)
+	}
+	unavailable, err := unavailableFoods(ctx, foodIds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking food availability"})
+		return false
+	}
+	if len(unavailable) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Some items are 86'd", "unavailable_foods": unavailable})
+		return false
+	}
+	offMenu, err := offMenuFoods(ctx, foodIds, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking menu schedules"})
+		return false
+	}
+	if len(offMenu) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Some items are not on a menu being served now", "inactive_foods": offMenu})
+		return false
+	}
+	return true
+}
+
+// resolveOrderItem prices an order item, either a single food with its
+// modifiers or a combo expanded into its component foods. It returns an error
+// message for invalid items and an error when the lookups fail.
+func resolveOrderItem(ctx context.Context, orderItem *models.OrderItem) (string, error) {
+	if orderItem.ComboID != nil {
+		if orderItem.FoodID != nil {
+			return "Set either food_id or combo_id, not both", nil
+		}
+		var combo models.Combo
+		err := comboCollection.FindOne(ctx, bson.M{"combo_id": orderItem.ComboID, "deleted_at": nil}).Decode(&combo)
+		if err == mongo.ErrNoDocuments {
+			return "Combo not found", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return priceComboItem(ctx, combo, orderItem)
+	}
+
+	if orderItem.FoodID == nil {
+		return "food_id or combo_id is required", nil
+	}
+	var food models.Food
+	err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.FoodID, "deleted_at": nil}).Decode(&food)
+	if err == mongo.ErrNoDocuments {
+		return "Food item not found", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	orderItem.Components = nil
+	return priceOrderItem(food, orderItem), nil
+}
+
+// orderItemFoodIDs lists the foods the kitchen prepares for an order item:
+// the food itself, or each component of a combo.
+func orderItemFoodIDs(orderItem models.OrderItem) []string {
+	if orderItem.FoodID != nil {
+		return []string{*orderItem.FoodID}
+	}
+	foodIds := []string{}
+	for _, component := range orderItem.Components {
+		foodIds = append(foodIds, component.FoodID)
+	}
+	return foodIds
+}
+
+func deductOrderItemStock(ctx context.Context, orderItem models.OrderItem) error {
+	if orderItem.Quantity == nil {
+		return nil
+	}
+	for _, foodId := range orderItemFoodIDs(orderItem) {
+		if err := deductStock(ctx, foodId, float64(*orderItem.Quantity)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreOrderItemStock(ctx context.Context, orderItem models.OrderItem) error {
+	if orderItem.Quantity == nil {
+		return nil
+	}
+	for _, foodId := range orderItemFoodIDs(orderItem) {
+		if err := restoreStock(ctx, foodId, float64(*orderItem.Quantity)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// priceOrderItem checks the modifiers chosen for an order item against the
+// food's modifier groups and sets the unit price to the food price plus the
+// price deltas of the chosen options. It returns an error message, or an empty
+// string when the item is valid.
+func priceOrderItem(food models.Food, orderItem *models.OrderItem) string {
+	groups := map[string]models.ModifierGroup{}
+	for _, group := range food.Modifier_groups {
+		groups[group.Group_id] = group
+	}
+
+	unitPrice := *food.Price
+	selections := map[string]int{}
+	chosen := map[string]bool{}
+	for i := range orderItem.Modifiers {
+		selected := &orderItem.Modifiers[i]
+		group, found := groups[selected.GroupID]
+		if !found {
+			return fmt.Sprintf("modifier group %s does not belong to %s", selected.GroupID, getStringValue(food.Name))
+		}
+
+		var option *models.ModifierOption
+		for j := range group.Options {
+			if group.Options[j].Option_id == selected.OptionID {
+				option = &group.Options[j]
+				break
+			}
+		}
+		if option == nil {
+			return fmt.Sprintf("option %s is not part of %s", selected.OptionID, group.Name)
+		}
+		if chosen[selected.OptionID] {
+			return fmt.Sprintf("option %s was chosen twice", option.Name)
+		}
+		chosen[selected.OptionID] = true
+
+		selected.Name = option.Name
+		selected.PriceDelta = option.Price_delta
+		unitPrice += option.Price_delta
+		selections[group.Group_id]++
+	}
+
+	for _, group := range food.Modifier_groups {
+		count := selections[group.Group_id]
+		minimum := group.Min_selections
+		if group.Required && minimum == 0 {
+			minimum = 1
+		}
+		if count == 0 && !group.Required {
+			continue
+		}
+		if count < minimum {
+			return fmt.Sprintf("choose at least %d option(s) for %s", minimum, group.Name)
+		}
+		if group.Max_selections > 0 && count > group.Max_selections {
+			return fmt.Sprintf("choose at most %d option(s) for %s", group.Max_selections, group.Name)
+		}
+	}
+
+	unitPrice = toFixed(unitPrice, 2)
+	orderItem.UnitPrice = &unitPrice
+	return ""
+}
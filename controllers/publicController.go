@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"golang-restrogo/models"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// publicCacheTTL bounds how stale a cached public response can get from
+// changes that don't invalidate the cache, like stock running out or a
+// daypart starting.
+const publicCacheTTL = 30 * time.Second
+
+// maxPublicCacheEntries caps the cache, since the routes need no login and
+// anyone can ask for another filter combination.
+const maxPublicCacheEntries = 256
+
+// PublicFood is the guest-facing view of a food, without internal fields.
+type PublicFood struct {
+	Food_id         string                 `json:"food_id"`
+	Name            string                 `json:"name"`
+	Price           float64                `json:"price"`
+	Description     string                 `json:"description,omitempty"`
+	Food_image      string                 `json:"food_image"`
+	Food_thumbnail  string                 `json:"food_thumbnail"`
+	Category        string                 `json:"category,omitempty"`
+	Allergens       []string               `json:"allergens"`
+	Dietary_tags    []string               `json:"dietary_tags"`
+	Menu_id         string                 `json:"menu_id"`
+	Modifier_groups []models.ModifierGroup `json:"modifier_groups"`
+}
+
+type PublicMenu struct {
+	Menu_id    string               `json:"menu_id"`
+	Name       string               `json:"name"`
+	Category   string               `json:"category"`
+	Dayparts   []models.Daypart     `json:"dayparts"`
+	Categories []PublicMenuCategory `json:"categories,omitempty"`
+}
+
+type PublicMenuCategory struct {
+	Name  string       `json:"name"`
+	Foods []PublicFood `json:"foods"`
+}
+
+type publicCacheEntry struct {
+	body         []byte
+	etag         string
+	lastModified time.Time
+	expires      time.Time
+}
+
+// publicResponseCache keeps rendered public responses in memory. Any write to
+// foods or menus drops the whole cache.
+type publicResponseCache struct {
+	mu      sync.RWMutex
+	entries map[string]publicCacheEntry
+}
+
+var publicCache = &publicResponseCache{entries: map[string]publicCacheEntry{}}
+
+func (cache *publicResponseCache) get(key string) (publicCacheEntry, bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	entry, found := cache.entries[key]
+	if !found || time.Now().After(entry.expires) {
+		return publicCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// set stores entry, dropping expired entries first. When the cache is still
+// full it makes room by dropping the entry closest to expiring.
+func (cache *publicResponseCache) set(key string, entry publicCacheEntry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+	for existingKey, existing := range cache.entries {
+		if now.After(existing.expires) {
+			delete(cache.entries, existingKey)
+		}
+	}
+	if _, found := cache.entries[key]; !found && len(cache.entries) >= maxPublicCacheEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for existingKey, existing := range cache.entries {
+			if oldestKey == "" || existing.expires.Before(oldest) {
+				oldestKey, oldest = existingKey, existing.expires
+			}
+		}
+		delete(cache.entries, oldestKey)
+	}
+	cache.entries[key] = entry
+}
+
+func (cache *publicResponseCache) invalidate() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries = map[string]publicCacheEntry{}
+}
+
+// GetPublicMenus lists the menus being served right now.
+func GetPublicMenus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		servePublic(c, "menus", func(ctx context.Context) (interface{}, time.Time, error) {
+			menus, err := activeMenus(ctx, time.Now())
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+
+			var lastModified time.Time
+			views := []PublicMenu{}
+			for _, menu := range menus {
+				views = append(views, publicMenu(menu))
+				lastModified = latest(lastModified, menu.Updated_at)
+			}
+			return views, lastModified, nil
+		})
+	}
+}
+
+// GetPublicFullMenu returns a menu being served right now with its available
+// foods grouped by category.
+func GetPublicFullMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		servePublic(c, "menus/"+c.Param("menu_id"), func(ctx context.Context) (interface{}, time.Time, error) {
+			view, err := fullMenu(ctx, c.Param("menu_id"))
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			if !isMenuActive(view.Menu, time.Now()) {
+				return nil, time.Time{}, mongo.ErrNoDocuments
+			}
+
+			lastModified := latest(time.Time{}, view.Updated_at)
+			menu := publicMenu(view.Menu)
+			menu.Categories = []PublicMenuCategory{}
+			for _, category := range view.Categories {
+				foods := []PublicFood{}
+				for _, food := range category.Foods {
+					lastModified = latest(lastModified, &food.Updated_at)
+					if food.Available {
+						foods = append(foods, publicFood(food.Food))
+					}
+				}
+				if len(foods) > 0 {
+					menu.Categories = append(menu.Categories, PublicMenuCategory{Name: category.Name, Foods: foods})
+				}
+			}
+			return menu, lastModified, nil
+		})
+	}
+}
+
+// GetPublicFoods lists the available foods of the menus being served right
+// now. Like GetFoods it accepts exclude_allergens and diet filters.
+func GetPublicFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := foodTagFilter(c)
+		if !ok {
+			return
+		}
+
+		servePublic(c, publicFoodsKey(c), func(ctx context.Context) (interface{}, time.Time, error) {
+			menus, err := activeMenus(ctx, time.Now())
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+
+			var lastModified time.Time
+			menuIds := []string{}
+			for _, menu := range menus {
+				menuIds = append(menuIds, menu.Menu_id)
+				lastModified = latest(lastModified, menu.Updated_at)
+			}
+
+			filter = append(filter, bson.E{Key: "menu_id", Value: bson.M{"$in": menuIds}}, bson.E{Key: "deleted_at", Value: nil})
+			cursor, err := foodCollection.Find(ctx, filter)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			var foods []models.Food
+			if err = cursor.All(ctx, &foods); err != nil {
+				return nil, time.Time{}, err
+			}
+
+			availability, err := foodAvailability(ctx, foods)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+
+			views := []PublicFood{}
+			for _, food := range foods {
+				lastModified = latest(lastModified, &food.Updated_at)
+				if availability[food.Food_id].Available {
+					views = append(views, publicFood(food))
+				}
+			}
+			return views, lastModified, nil
+		})
+	}
+}
+
+// publicFoodsKey is the cache key of GetPublicFoods: its filters in a fixed
+// order, so the same filter spelled differently shares one entry and query
+// parameters the route doesn't read are ignored. Call it only once
+// foodTagFilter has accepted the parameters.
+func publicFoodsKey(c *gin.Context) string {
+	allergens, _ := parseAllergens(c.Query("exclude_allergens"))
+	tags, _ := parseDietaryTags(c.Query("diet"))
+	return "foods?exclude_allergens=" + strings.Join(sortedUnique(allergens), ",") +
+		"&diet=" + strings.Join(sortedUnique(tags), ",")
+}
+
+func sortedUnique(values []string) []string {
+	unique := []string{}
+	for _, value := range values {
+		if !contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// servePublic answers a public GET from the cache under key when it can,
+// otherwise builds, caches and sends the response. Not-found responses are
+// not cached. Responses carry an ETag computed
+// from the body and a Last-Modified from the newest Updated_at they include,
+// and conditional requests that still match get a 304.
+func servePublic(c *gin.Context, key string, build func(ctx context.Context) (interface{}, time.Time, error)) {
+	entry, found := publicCache.get(key)
+	if !found {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		data, lastModified, err := build(ctx)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while loading the menu"})
+			return
+		}
+
+		body, err := json.Marshal(data)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sum := sha256.Sum256(body)
+		entry = publicCacheEntry{
+			body:         body,
+			etag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+			lastModified: lastModified.UTC().Truncate(time.Second),
+			expires:      time.Now().Add(publicCacheTTL),
+		}
+		publicCache.set(key, entry)
+	}
+
+	c.Header("ETag", entry.etag)
+	c.Header("Cache-Control", "public, max-age=30")
+	if !entry.lastModified.IsZero() {
+		c.Header("Last-Modified", entry.lastModified.Format(http.TimeFormat))
+	}
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if match == entry.etag || match == "*" {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	} else if since := c.GetHeader("If-Modified-Since"); since != "" && !entry.lastModified.IsZero() {
+		if sinceTime, err := http.ParseTime(since); err == nil && !entry.lastModified.After(sinceTime) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", entry.body)
+}
+
+func publicMenu(menu models.Menu) PublicMenu {
+	dayparts := menu.Dayparts
+	if dayparts == nil {
+		dayparts = []models.Daypart{}
+	}
+	return PublicMenu{
+		Menu_id:  menu.Menu_id,
+		Name:     menu.Name,
+		Category: menu.Category,
+		Dayparts: dayparts,
+	}
+}
+
+func publicFood(food models.Food) PublicFood {
+	view := PublicFood{
+		Food_id:         food.Food_id,
+		Name:            getStringValue(food.Name),
+		Description:     getStringValue(food.Description),
+		Allergens:       nonNilStrings(food.Allergens),
+		Dietary_tags:    nonNilStrings(food.Dietary_tags),
+		Modifier_groups: food.Modifier_groups,
+	}
+	if food.Price != nil {
+		view.Price = *food.Price
+	}
+	if food.Food_image != nil {
+		view.Food_image = *food.Food_image
+	}
+	if food.Food_thumbnail != nil {
+		view.Food_thumbnail = *food.Food_thumbnail
+	}
+	if food.Category != nil {
+		view.Category = *food.Category
+	}
+	if food.Menu_id != nil {
+		view.Menu_id = *food.Menu_id
+	}
+	if view.Modifier_groups == nil {
+		view.Modifier_groups = []models.ModifierGroup{}
+	}
+	return view
+}
+
+func latest(current time.Time, candidate *time.Time) time.Time {
+	if candidate != nil && candidate.After(current) {
+		return *candidate
+	}
+	return current
+}
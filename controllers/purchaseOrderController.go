@@ -0,0 +1,479 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var purchaseOrderCollection = database.OpenCollection(database.Client, "purchaseOrder")
+
+type ReceivePurchaseOrderRequest struct {
+	Lines []ReceivedLine `json:"lines" validate:"required,min=1,dive"`
+}
+
+type ReceivedLine struct {
+	Ingredient_id string   `json:"ingredient_id" validate:"required"`
+	Quantity      float64  `json:"quantity" validate:"required,gt=0"`
+	Unit_cost     *float64 `json:"unit_cost" validate:"required,gte=0"`
+}
+
+type SuggestedPurchaseOrders struct {
+	Purchase_orders []models.PurchaseOrder `json:"purchase_orders"`
+	// Low-stock ingredients that have no preferred supplier to order from.
+	Without_supplier []models.Ingredient `json:"without_supplier"`
+}
+
+func GetPurchaseOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, purchaseOrderCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"status": "string", "supplier_id": "string", "created_at": "date"},
+			Sorts:       []string{"ordered_at", "received_at", "created_at", "updated_at"},
+			DefaultSort: "-created_at",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetPurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		purchaseOrderId := c.Param("purchase_order_id")
+		var purchaseOrder models.PurchaseOrder
+
+		filter := bson.M{"purchase_order_id": purchaseOrderId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := purchaseOrderCollection.FindOne(ctx, filter).Decode(&purchaseOrder)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "purchase order not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the purchase order"})
+			return
+		}
+
+		setETag(c, purchaseOrder.Version)
+		c.JSON(http.StatusOK, purchaseOrder)
+	}
+}
+
+func CreatePurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var purchaseOrder models.PurchaseOrder
+
+		if err := c.BindJSON(&purchaseOrder); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(purchaseOrder); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if msg := checkPurchaseOrderRefs(ctx, purchaseOrder); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		now := time.Now()
+		purchaseOrder.ID = primitive.NewObjectID()
+		purchaseOrder.Purchase_order_id = purchaseOrder.ID.Hex()
+		purchaseOrder.Version = 1
+		purchaseOrder.Status = "DRAFT"
+		purchaseOrder.Ordered_at = nil
+		purchaseOrder.Received_at = nil
+		purchaseOrder.Created_at = now
+		purchaseOrder.Updated_at = now
+		for i := range purchaseOrder.Lines {
+			purchaseOrder.Lines[i].Received_quantity = 0
+		}
+
+		_, insertErr := purchaseOrderCollection.InsertOne(ctx, purchaseOrder)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "purchase order could not be created"})
+			return
+		}
+
+		setETag(c, purchaseOrder.Version)
+		c.JSON(http.StatusOK, purchaseOrder)
+	}
+}
+
+// UpdatePurchaseOrder edits the lines of a draft and moves a purchase order to
+// ORDERED or CANCELLED. Receiving goes through ReceivePurchaseOrder.
+func UpdatePurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		purchaseOrderId := c.Param("purchase_order_id")
+		var request models.PurchaseOrder
+		var purchaseOrder models.PurchaseOrder
+
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{"purchase_order_id": purchaseOrderId}
+		err := purchaseOrderCollection.FindOne(ctx, filter).Decode(&purchaseOrder)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "purchase order not found"})
+			return
+		}
+
+		now := time.Now()
+		update := bson.D{}
+		if len(request.Lines) > 0 {
+			if purchaseOrder.Status != "DRAFT" {
+				c.JSON(http.StatusConflict, gin.H{"error": "only draft purchase orders can be edited"})
+				return
+			}
+			if validationErr := validate.Var(request.Lines, "dive"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			request.Supplier_id = purchaseOrder.Supplier_id
+			if msg := checkPurchaseOrderRefs(ctx, request); msg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			update = append(update, bson.E{Key: "lines", Value: request.Lines})
+		}
+		if request.Status != "" && request.Status != purchaseOrder.Status {
+			switch {
+			case request.Status == "ORDERED" && purchaseOrder.Status == "DRAFT":
+				update = append(update, bson.E{Key: "ordered_at", Value: now})
+			case request.Status == "CANCELLED" && (purchaseOrder.Status == "DRAFT" || purchaseOrder.Status == "ORDERED"):
+			default:
+				msg := fmt.Sprintf("cannot move a %s purchase order to %s", purchaseOrder.Status, request.Status)
+				c.JSON(http.StatusConflict, gin.H{"error": msg})
+				return
+			}
+			update = append(update, bson.E{Key: "status", Value: request.Status})
+		}
+		update = append(update, bson.E{Key: "updated_at", Value: now})
+
+		result, err := purchaseOrderCollection.UpdateOne(ctx,
+			versionFilter("purchase_order_id", purchaseOrderId, version),
+			bson.D{{Key: "$set", Value: update}, bumpVersion},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "purchase order update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			versionMismatch(ctx, c, purchaseOrderCollection, "purchase_order_id", purchaseOrderId, "purchase order")
+			return
+		}
+
+		var updatedPurchaseOrder models.PurchaseOrder
+		if err := purchaseOrderCollection.FindOne(ctx, filter).Decode(&updatedPurchaseOrder); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated purchase order"})
+			return
+		}
+		setETag(c, updatedPurchaseOrder.Version)
+		c.JSON(http.StatusOK, updatedPurchaseOrder)
+	}
+}
+
+// ReceivePurchaseOrder books a delivery: stock goes up, the ingredient takes
+// the delivered unit cost and the supplier price history gets a new entry,
+// all in one transaction.
+func ReceivePurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		purchaseOrderId := c.Param("purchase_order_id")
+		var request ReceivePurchaseOrderRequest
+		var purchaseOrder models.PurchaseOrder
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// The delivery is booked in one transaction, read included, so stock
+		// only goes up when the purchase order records it, and two receives
+		// at once cannot lose each other's quantities.
+		err := inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+			err := purchaseOrderCollection.FindOne(sessionCtx, bson.M{"purchase_order_id": purchaseOrderId, "deleted_at": nil}).Decode(&purchaseOrder)
+			if err == mongo.ErrNoDocuments {
+				return &abortError{http.StatusNotFound, "purchase order not found"}
+			}
+			if err != nil {
+				return err
+			}
+			if purchaseOrder.Status != "ORDERED" && purchaseOrder.Status != "PARTIALLY_RECEIVED" {
+				return &abortError{http.StatusConflict, fmt.Sprintf("cannot receive a %s purchase order", purchaseOrder.Status)}
+			}
+
+			lineIndex := map[string]int{}
+			for i, line := range purchaseOrder.Lines {
+				lineIndex[line.Ingredient_id] = i
+			}
+			for _, received := range request.Lines {
+				if _, found := lineIndex[received.Ingredient_id]; !found {
+					return &abortError{http.StatusBadRequest, fmt.Sprintf("ingredient %s is not on this purchase order", received.Ingredient_id)}
+				}
+			}
+
+			now := time.Now()
+			for _, received := range request.Lines {
+				_, err := ingredientCollection.UpdateOne(sessionCtx,
+					bson.M{"ingredient_id": received.Ingredient_id},
+					bson.D{
+						{Key: "$inc", Value: bson.D{{Key: "stock_quantity", Value: received.Quantity}, {Key: "version", Value: 1}}},
+						{Key: "$set", Value: bson.D{
+							{Key: "unit_cost", Value: *received.Unit_cost},
+							{Key: "updated_at", Value: now},
+						}},
+					},
+				)
+				if err != nil {
+					return err
+				}
+
+				price := models.SupplierPrice{
+					ID:                primitive.NewObjectID(),
+					Supplier_id:       *purchaseOrder.Supplier_id,
+					Ingredient_id:     received.Ingredient_id,
+					Purchase_order_id: purchaseOrder.Purchase_order_id,
+					Quantity:          received.Quantity,
+					Unit_cost:         *received.Unit_cost,
+					Recorded_at:       now,
+				}
+				if _, err := supplierPriceCollection.InsertOne(sessionCtx, price); err != nil {
+					return err
+				}
+
+				line := &purchaseOrder.Lines[lineIndex[received.Ingredient_id]]
+				line.Received_quantity += received.Quantity
+				line.Unit_cost = received.Unit_cost
+			}
+
+			purchaseOrder.Status = "RECEIVED"
+			for _, line := range purchaseOrder.Lines {
+				if line.Received_quantity < line.Quantity {
+					purchaseOrder.Status = "PARTIALLY_RECEIVED"
+					break
+				}
+			}
+			purchaseOrder.Received_at = &now
+			purchaseOrder.Updated_at = now
+
+			result, err := purchaseOrderCollection.UpdateOne(sessionCtx,
+				versionFilter("purchase_order_id", purchaseOrderId, purchaseOrder.Version),
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "lines", Value: purchaseOrder.Lines},
+					{Key: "status", Value: purchaseOrder.Status},
+					{Key: "received_at", Value: now},
+					{Key: "updated_at", Value: now},
+				}}, bumpVersion},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return &abortError{http.StatusConflict, "purchase order was changed while receiving; fetch it again and retry"}
+			}
+			purchaseOrder.Version++
+			return nil
+		})
+		if err != nil {
+			rollbackResponse(c, err, "receiving")
+			return
+		}
+
+		setETag(c, purchaseOrder.Version)
+		c.JSON(http.StatusOK, purchaseOrder)
+	}
+}
+
+// GetSuggestedPurchaseOrders previews the draft purchase orders that
+// CreateSuggestedPurchaseOrders would create.
+func GetSuggestedPurchaseOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		suggested, err := suggestPurchaseOrders(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while suggesting purchase orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, suggested)
+	}
+}
+
+func CreateSuggestedPurchaseOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		suggested, err := suggestPurchaseOrders(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while suggesting purchase orders"})
+			return
+		}
+
+		for _, purchaseOrder := range suggested.Purchase_orders {
+			if _, err := purchaseOrderCollection.InsertOne(ctx, purchaseOrder); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "purchase order could not be created"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, suggested)
+	}
+}
+
+// suggestPurchaseOrders drafts one purchase order per preferred supplier for
+// every ingredient at or below its reorder level. Ingredients already on an
+// open purchase order are skipped so repeated runs don't double-order.
+func suggestPurchaseOrders(ctx context.Context) (SuggestedPurchaseOrders, error) {
+	suggested := SuggestedPurchaseOrders{
+		Purchase_orders:  []models.PurchaseOrder{},
+		Without_supplier: []models.Ingredient{},
+	}
+
+	cursor, err := ingredientCollection.Find(ctx, bson.M{
+		"reorder_level": bson.M{"$ne": nil},
+		"$expr":         bson.M{"$lte": bson.A{"$stock_quantity", "$reorder_level"}},
+		"deleted_at":    nil,
+	})
+	if err != nil {
+		return suggested, err
+	}
+	var lowStock []models.Ingredient
+	if err = cursor.All(ctx, &lowStock); err != nil {
+		return suggested, err
+	}
+
+	cursor, err = purchaseOrderCollection.Find(ctx, bson.M{
+		"status":     bson.M{"$in": bson.A{"DRAFT", "ORDERED", "PARTIALLY_RECEIVED"}},
+		"deleted_at": nil,
+	})
+	if err != nil {
+		return suggested, err
+	}
+	var openOrders []models.PurchaseOrder
+	if err = cursor.All(ctx, &openOrders); err != nil {
+		return suggested, err
+	}
+
+	onOrder := map[string]bool{}
+	for _, purchaseOrder := range openOrders {
+		for _, line := range purchaseOrder.Lines {
+			onOrder[line.Ingredient_id] = true
+		}
+	}
+
+	now := time.Now()
+	bySupplier := map[string]int{}
+	for _, ingredient := range lowStock {
+		if onOrder[ingredient.Ingredient_id] {
+			continue
+		}
+		if ingredient.Supplier_id == nil {
+			suggested.Without_supplier = append(suggested.Without_supplier, ingredient)
+			continue
+		}
+
+		// Without an explicit reorder quantity, top up to twice the reorder level.
+		stock := 0.0
+		if ingredient.Stock_quantity != nil {
+			stock = *ingredient.Stock_quantity
+		}
+		quantity := 2*(*ingredient.Reorder_level) - stock
+		if ingredient.Reorder_quantity != nil {
+			quantity = *ingredient.Reorder_quantity
+		}
+		if quantity <= 0 {
+			continue
+		}
+
+		line := models.PurchaseOrderLine{
+			Ingredient_id: ingredient.Ingredient_id,
+			Quantity:      toFixed(quantity, 3),
+			Unit_cost:     ingredient.Unit_cost,
+		}
+
+		i, found := bySupplier[*ingredient.Supplier_id]
+		if !found {
+			purchaseOrder := models.PurchaseOrder{
+				ID:          primitive.NewObjectID(),
+				Supplier_id: ingredient.Supplier_id,
+				Status:      "DRAFT",
+				Lines:       []models.PurchaseOrderLine{},
+				Created_at:  now,
+				Updated_at:  now,
+			}
+			purchaseOrder.Purchase_order_id = purchaseOrder.ID.Hex()
+			purchaseOrder.Version = 1
+			suggested.Purchase_orders = append(suggested.Purchase_orders, purchaseOrder)
+			i = len(suggested.Purchase_orders) - 1
+			bySupplier[*ingredient.Supplier_id] = i
+		}
+		suggested.Purchase_orders[i].Lines = append(suggested.Purchase_orders[i].Lines, line)
+	}
+
+	return suggested, nil
+}
+
+// checkPurchaseOrderRefs returns an error message when the supplier or one of
+// the ingredients of a purchase order does not exist.
+func checkPurchaseOrderRefs(ctx context.Context, purchaseOrder models.PurchaseOrder) string {
+	count, err := supplierCollection.CountDocuments(ctx, bson.M{"supplier_id": purchaseOrder.Supplier_id, "deleted_at": nil})
+	if err != nil || count == 0 {
+		return "supplier was not found"
+	}
+
+	seen := map[string]bool{}
+	for _, line := range purchaseOrder.Lines {
+		if seen[line.Ingredient_id] {
+			return fmt.Sprintf("ingredient %s is listed twice", line.Ingredient_id)
+		}
+		seen[line.Ingredient_id] = true
+
+		count, err := ingredientCollection.CountDocuments(ctx, bson.M{"ingredient_id": line.Ingredient_id, "deleted_at": nil})
+		if err != nil || count == 0 {
+			return fmt.Sprintf("ingredient %s was not found", line.Ingredient_id)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var recipeCollection = database.OpenCollection(database.Client, "recipe")
+
+func GetRecipes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, recipeCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"food_id": "string"},
+			Sorts:       []string{"created_at", "updated_at"},
+			DefaultSort: "-created_at",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// GetRecipe returns the recipe of a food; every food has at most one.
+func GetRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		var recipe models.Recipe
+
+		err := recipeCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&recipe)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "recipe not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the recipe"})
+			return
+		}
+
+		setETag(c, recipe.Version)
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+// SaveRecipe creates the recipe for a food, replacing the previous one if any.
+// Replacing a recipe needs its ETag in If-Match.
+func SaveRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var recipe models.Recipe
+		var food models.Food
+
+		if err := c.BindJSON(&recipe); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(recipe); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		err := foodCollection.FindOne(ctx, bson.M{"food_id": recipe.Food_id, "deleted_at": nil}).Decode(&food)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "food was not found"})
+			return
+		}
+
+		for _, recipeIngredient := range recipe.Ingredients {
+			count, err := ingredientCollection.CountDocuments(ctx, bson.M{"ingredient_id": recipeIngredient.Ingredient_id, "deleted_at": nil})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking ingredients"})
+				return
+			}
+			if count == 0 {
+				msg := fmt.Sprintf("ingredient %s was not found", recipeIngredient.Ingredient_id)
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+		}
+
+		now := time.Now()
+		var existing models.Recipe
+		err = recipeCollection.FindOne(ctx, bson.M{"food_id": recipe.Food_id}).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the recipe"})
+			return
+		}
+		recipe.Updated_at = now
+
+		if err == nil {
+			version, ok := ifMatch(c)
+			if !ok {
+				return
+			}
+			recipe.ID = existing.ID
+			recipe.Recipe_id = existing.Recipe_id
+			recipe.Created_at = existing.Created_at
+			recipe.Version = version + 1
+
+			result, err := recipeCollection.ReplaceOne(ctx, versionFilter("food_id", *recipe.Food_id, version), recipe)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "recipe could not be saved"})
+				return
+			}
+			if result.MatchedCount == 0 {
+				versionMismatch(ctx, c, recipeCollection, "food_id", *recipe.Food_id, "recipe")
+				return
+			}
+		} else {
+			recipe.ID = primitive.NewObjectID()
+			recipe.Recipe_id = recipe.ID.Hex()
+			recipe.Created_at = now
+			recipe.Version = 1
+
+			// The upsert only inserts when the food still has no recipe, so a
+			// recipe saved in the meantime is not replaced blindly.
+			result, err := recipeCollection.UpdateOne(ctx,
+				bson.M{"food_id": recipe.Food_id},
+				bson.D{{Key: "$setOnInsert", Value: recipe}},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "recipe could not be saved"})
+				return
+			}
+			if result.UpsertedCount == 0 {
+				versionMismatch(ctx, c, recipeCollection, "food_id", *recipe.Food_id, "recipe")
+				return
+			}
+		}
+
+		if err := deriveFoodTags(ctx, c, []string{*recipe.Food_id}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "recipe was saved but the food's allergens could not be derived"})
+			return
+		}
+
+		setETag(c, recipe.Version)
+		c.JSON(http.StatusOK, recipe)
+	}
+}
@@ -0,0 +1,479 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var salesGroupings = []string{"day", "hour", "food", "category", "table", "waiter", "payment_method"}
+
+// SalesFigures are the sales of one group of a report. Gross is what was sold
+// before discounts, Net what remains after them, and Total adds the tax back.
+// Items counts the units sold, with each food of a combo counted on its own.
+type SalesFigures struct {
+	Gross     float64 `json:"gross"`
+	Discounts float64 `json:"discounts"`
+	Net       float64 `json:"net"`
+	Tax       float64 `json:"tax"`
+	Total     float64 `json:"total"`
+	Items     int     `json:"items"`
+	Orders    int     `json:"orders"`
+}
+
+type SalesReportRow struct {
+	Key          interface{} `json:"key"`
+	Label        *string     `json:"label"`
+	SalesFigures `bson:",inline"`
+}
+
+type SalesReport struct {
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Timezone string           `json:"timezone"`
+	Group_by string           `json:"group_by"`
+	Totals   SalesFigures     `json:"totals"`
+	Rows     []SalesReportRow `json:"rows"`
+}
+
+// GetSalesReport sums the invoices created between from and to, PAID ones by
+// default, grouped by day, hour, food, category, table, waiter or
+// payment_method. Invoice discounts and tax are spread over the lines of the
+// order in proportion to their amount, and combos count at the price
+// allocated to each of their foods, so every grouping adds up to the same
+// totals.
+func GetSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		report := SalesReport{
+			Timezone: c.DefaultQuery("tz", "UTC"),
+			Group_by: c.DefaultQuery("group_by", "day"),
+		}
+		if !contains(salesGroupings, report.Group_by) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be one of " + strings.Join(salesGroupings, ", ")})
+			return
+		}
+		location, err := time.LoadLocation(report.Timezone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tz must be an IANA time zone such as Europe/Paris"})
+			return
+		}
+
+		var msg string
+		report.From, report.To, msg = reportRange(c, location)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		statuses := bson.A{"PAID"}
+		switch status := c.DefaultQuery("payment_status", "PAID"); status {
+		case "PAID":
+		case "PENDING":
+			statuses = bson.A{"PENDING"}
+		case "all":
+			statuses = bson.A{"PAID", "PENDING"}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "payment_status must be PAID, PENDING or all"})
+			return
+		}
+
+		match := bson.D{
+			{Key: "created_at", Value: bson.D{{Key: "$gte", Value: report.From}, {Key: "$lt", Value: report.To}}},
+			{Key: "payment_status", Value: bson.D{{Key: "$in", Value: statuses}}},
+		}
+		cursor, err := invoiceCollection.Aggregate(ctx, salesPipeline(match, report.Group_by, report.Timezone))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while building the sales report"})
+			return
+		}
+		var results []struct {
+			Rows   []SalesReportRow `bson:"rows"`
+			Totals []SalesFigures   `bson:"totals"`
+		}
+		if err = cursor.All(ctx, &results); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		report.Rows = []SalesReportRow{}
+		if len(results) > 0 {
+			report.Rows = append(report.Rows, results[0].Rows...)
+			if len(results[0].Totals) > 0 {
+				report.Totals = results[0].Totals[0]
+			}
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// reportRange reads from and to, as RFC3339 times or as dates in location.
+// A date for to includes that whole day. The range defaults to the last 30
+// days.
+func reportRange(c *gin.Context, location *time.Location) (time.Time, time.Time, string) {
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, dateOnly, ok := parseReportTime(value, location)
+		if !ok {
+			return time.Time{}, time.Time{}, "to must be a date (2006-01-02) or an RFC3339 time"
+		}
+		to = parsed
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, _, ok := parseReportTime(value, location)
+		if !ok {
+			return time.Time{}, time.Time{}, "from must be a date (2006-01-02) or an RFC3339 time"
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, "from must be before to"
+	}
+	return from, to, ""
+}
+
+func parseReportTime(value string, location *time.Location) (time.Time, bool, bool) {
+	if parsed, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return parsed, true, true
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, false, true
+	}
+	return time.Time{}, false, false
+}
+
+// salesPipeline turns the invoices matching match into one line per food
+// sold, then groups the lines by groupBy into rows and totals.
+func salesPipeline(match bson.D, groupBy, timezone string) mongo.Pipeline {
+	match = append(match, bson.E{Key: "deleted_at", Value: nil})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: orderCollection.Name()},
+			{Key: "localField", Value: "order_id"},
+			{Key: "foreignField", Value: "order_id"},
+			{Key: "as", Value: "order"},
+		}}},
+		{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: orderItemCollection.Name()},
+			{Key: "let", Value: bson.D{{Key: "order_id", Value: "$order_id"}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$order_id", "$$order_id"}}}},
+					{Key: "voided_at", Value: nil},
+					{Key: "deleted_at", Value: nil},
+				}}},
+			}},
+			{Key: "as", Value: "item"},
+		}}},
+		{{Key: "$unwind", Value: "$item"}},
+		// A combo is sold as the foods it is made of, at their allocated price.
+		{{Key: "$addFields", Value: bson.D{{Key: "line", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gt", Value: bson.A{bson.D{{Key: "$size", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$item.components", bson.A{}}}}}}, 0}}},
+			bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: "$item.components"},
+				{Key: "as", Value: "component"},
+				{Key: "in", Value: bson.D{
+					{Key: "food_id", Value: "$$component.food_id"},
+					{Key: "quantity", Value: "$item.quantity"},
+					{Key: "amount", Value: bson.D{{Key: "$multiply", Value: bson.A{"$$component.allocated_price", "$item.quantity"}}}},
+				}},
+			}}},
+			bson.A{bson.D{
+				{Key: "food_id", Value: "$item.food_id"},
+				{Key: "quantity", Value: "$item.quantity"},
+				{Key: "amount", Value: bson.D{{Key: "$multiply", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$item.unit_price", 0}}}, "$item.quantity"}}}},
+			}},
+		}}}}}}},
+		{{Key: "$unwind", Value: "$line"}},
+		// Each line carries its share of the invoice discount and tax.
+		{{Key: "$addFields", Value: bson.D{{Key: "share", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gt", Value: bson.A{"$subtotal", 0}}},
+			bson.D{{Key: "$divide", Value: bson.A{"$line.amount", "$subtotal"}}},
+			0,
+		}}}}}}},
+	}
+
+	if groupBy == "food" || groupBy == "category" {
+		pipeline = append(pipeline,
+			bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: foodCollection.Name()},
+				{Key: "localField", Value: "line.food_id"},
+				{Key: "foreignField", Value: "food_id"},
+				{Key: "as", Value: "food"},
+			}}},
+			bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$food"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+		)
+	}
+
+	sums := bson.D{
+		{Key: "gross", Value: bson.D{{Key: "$sum", Value: "$line.amount"}}},
+		{Key: "discounts", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$multiply", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$discount", 0}}}, "$share"}}}}}},
+		{Key: "tax", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$multiply", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$tax", 0}}}, "$share"}}}}}},
+		{Key: "items", Value: bson.D{{Key: "$sum", Value: "$line.quantity"}}},
+		{Key: "orders", Value: bson.D{{Key: "$addToSet", Value: "$order_id"}}},
+	}
+	figures := bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "gross", Value: bson.D{{Key: "$round", Value: bson.A{"$gross", 2}}}},
+		{Key: "discounts", Value: bson.D{{Key: "$round", Value: bson.A{"$discounts", 2}}}},
+		{Key: "net", Value: bson.D{{Key: "$round", Value: bson.A{bson.D{{Key: "$subtract", Value: bson.A{"$gross", "$discounts"}}}, 2}}}},
+		{Key: "tax", Value: bson.D{{Key: "$round", Value: bson.A{"$tax", 2}}}},
+		{Key: "total", Value: bson.D{{Key: "$round", Value: bson.A{bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$subtract", Value: bson.A{"$gross", "$discounts"}}}, "$tax"}}}, 2}}}},
+		{Key: "items", Value: 1},
+		{Key: "orders", Value: bson.D{{Key: "$size", Value: "$orders"}}},
+	}
+
+	rowGroup := append(bson.D{{Key: "_id", Value: salesGroupKey(groupBy, timezone)}}, sums...)
+	if groupBy == "food" {
+		rowGroup = append(rowGroup, bson.E{Key: "label", Value: bson.D{{Key: "$first", Value: "$food.name"}}})
+	}
+	rows := bson.A{bson.D{{Key: "$group", Value: rowGroup}}}
+	rows = append(rows, salesLabelStages(groupBy)...)
+	rows = append(rows,
+		bson.D{{Key: "$project", Value: append(bson.D{{Key: "key", Value: "$_id"}, {Key: "label", Value: 1}}, figures...)}},
+	)
+	if groupBy == "day" || groupBy == "hour" {
+		rows = append(rows, bson.D{{Key: "$sort", Value: bson.D{{Key: "key", Value: 1}}}})
+	} else {
+		rows = append(rows, bson.D{{Key: "$sort", Value: bson.D{{Key: "net", Value: -1}, {Key: "key", Value: 1}}}})
+	}
+
+	totals := bson.A{
+		bson.D{{Key: "$group", Value: append(bson.D{{Key: "_id", Value: nil}}, sums...)}},
+		bson.D{{Key: "$project", Value: figures}},
+	}
+
+	return append(pipeline, bson.D{{Key: "$facet", Value: bson.D{{Key: "rows", Value: rows}, {Key: "totals", Value: totals}}}})
+}
+
+func salesGroupKey(groupBy, timezone string) interface{} {
+	switch groupBy {
+	case "day":
+		return bson.D{{Key: "$dateToString", Value: bson.D{{Key: "format", Value: "%Y-%m-%d"}, {Key: "date", Value: "$created_at"}, {Key: "timezone", Value: timezone}}}}
+	case "hour":
+		return bson.D{{Key: "$hour", Value: bson.D{{Key: "date", Value: "$created_at"}, {Key: "timezone", Value: timezone}}}}
+	case "food":
+		return "$line.food_id"
+	case "category":
+		return "$food.category"
+	case "table":
+		return "$order.table_id"
+	case "waiter":
+		return "$order.waiter_id"
+	}
+	return "$payment_method"
+}
+
+// salesLabelStages names the tables and waiters of grouped rows.
+func salesLabelStages(groupBy string) bson.A {
+	var from, foreignField string
+	var label interface{}
+	switch groupBy {
+	case "table":
+		from, foreignField = tableCollection.Name(), "table_id"
+		label = bson.D{{Key: "$toString", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$labelled.number", 0}}}}}
+	case "waiter":
+		from, foreignField = userCollection.Name(), "user_id"
+		label = bson.D{{Key: "$trim", Value: bson.D{{Key: "input", Value: bson.D{{Key: "$concat", Value: bson.A{
+			bson.D{{Key: "$ifNull", Value: bson.A{bson.D{{Key: "$arrayElemAt", Value: bson.A{"$labelled.first_name", 0}}}, ""}}},
+			" ",
+			bson.D{{Key: "$ifNull", Value: bson.A{bson.D{{Key: "$arrayElemAt", Value: bson.A{"$labelled.last_name", 0}}}, ""}}},
+		}}}}}}}
+	default:
+		return bson.A{}
+	}
+
+	return bson.A{
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: from},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: foreignField},
+			{Key: "as", Value: "labelled"},
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: "label", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gt", Value: bson.A{bson.D{{Key: "$size", Value: "$labelled"}}, 0}}},
+			label,
+			nil,
+		}}}}}}},
+	}
+}
+
+// MenuEngineeringItem is a food of the menu-engineering report. Items_sold
+// and Revenue (net of discounts) come from paid invoices, Popularity is its
+// share of the items sold in percent, and Total_margin is its margin times
+// the items sold.
+type MenuEngineeringItem struct {
+	FoodCost
+	Items_sold   int      `json:"items_sold"`
+	Revenue      float64  `json:"revenue"`
+	Popularity   float64  `json:"popularity"`
+	Total_margin *float64 `json:"total_margin"`
+	Class        *string  `json:"class"`
+}
+
+type MenuEngineeringReport struct {
+	From                 time.Time             `json:"from"`
+	To                   time.Time             `json:"to"`
+	Timezone             string                `json:"timezone"`
+	Popularity_threshold float64               `json:"popularity_threshold"`
+	Margin_threshold     float64               `json:"margin_threshold"`
+	Items                []MenuEngineeringItem `json:"items"`
+}
+
+// GetMenuEngineeringReport classifies foods by how well they sell and how
+// much they earn between from and to, optionally only those of menu_id or
+// category. A food is popular when it sold at least 70% of an equal share of
+// the items sold, and profitable when its margin is at least the average
+// margin weighted by the items sold. Stars are both, plowhorses only popular,
+// puzzles only profitable and dogs neither. Foods without a known cost are
+// listed without a class and left out of the thresholds.
+func GetMenuEngineeringReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		report := MenuEngineeringReport{Timezone: c.DefaultQuery("tz", "UTC")}
+		location, err := time.LoadLocation(report.Timezone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tz must be an IANA time zone such as Europe/Paris"})
+			return
+		}
+		var msg string
+		report.From, report.To, msg = reportRange(c, location)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		foodFilter := bson.M{"deleted_at": nil}
+		if menuId := c.Query("menu_id"); menuId != "" {
+			foodFilter["menu_id"] = menuId
+		}
+		if category := c.Query("category"); category != "" {
+			foodFilter["category"] = category
+		}
+		cursor, err := foodCollection.Find(ctx, foodFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing foods"})
+			return
+		}
+		var foods []models.Food
+		if err = cursor.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		costs, err := foodCosts(ctx, foods)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while costing foods"})
+			return
+		}
+
+		match := bson.D{
+			{Key: "created_at", Value: bson.D{{Key: "$gte", Value: report.From}, {Key: "$lt", Value: report.To}}},
+			{Key: "payment_status", Value: "PAID"},
+		}
+		cursor, err = invoiceCollection.Aggregate(ctx, salesPipeline(match, "food", report.Timezone))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while building the menu engineering report"})
+			return
+		}
+		var results []struct {
+			Rows []SalesReportRow `bson:"rows"`
+		}
+		if err = cursor.All(ctx, &results); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sales := map[string]SalesFigures{}
+		if len(results) > 0 {
+			for _, row := range results[0].Rows {
+				if foodId, ok := row.Key.(string); ok {
+					sales[foodId] = row.SalesFigures
+				}
+			}
+		}
+
+		report.Items = []MenuEngineeringItem{}
+		itemsSold, costedItemsSold, costedFoods := 0, 0, 0
+		weightedMargin, marginSum := 0.0, 0.0
+		for _, food := range foods {
+			item := MenuEngineeringItem{
+				FoodCost:   costs[food.Food_id],
+				Items_sold: sales[food.Food_id].Items,
+				Revenue:    sales[food.Food_id].Net,
+			}
+			itemsSold += item.Items_sold
+			if item.Margin != nil {
+				totalMargin := toFixed(*item.Margin*float64(item.Items_sold), 2)
+				item.Total_margin = &totalMargin
+				costedFoods++
+				costedItemsSold += item.Items_sold
+				weightedMargin += totalMargin
+				marginSum += *item.Margin
+			}
+			report.Items = append(report.Items, item)
+		}
+
+		if costedFoods > 0 {
+			report.Popularity_threshold = toFixed(100/float64(costedFoods)*0.7, 2)
+			if costedItemsSold > 0 {
+				report.Margin_threshold = toFixed(weightedMargin/float64(costedItemsSold), 2)
+			} else {
+				report.Margin_threshold = toFixed(marginSum/float64(costedFoods), 2)
+			}
+		}
+
+		for i := range report.Items {
+			item := &report.Items[i]
+			if itemsSold > 0 {
+				item.Popularity = toFixed(float64(item.Items_sold)/float64(itemsSold)*100, 2)
+			}
+			if item.Margin == nil {
+				continue
+			}
+			// Popularity is measured among the foods that have a cost, like
+			// the threshold it is compared with.
+			popular := false
+			if costedItemsSold > 0 {
+				popular = float64(item.Items_sold)/float64(costedItemsSold)*100 >= report.Popularity_threshold
+			}
+			profitable := *item.Margin >= report.Margin_threshold
+			class := menuEngineeringClass(popular, profitable)
+			item.Class = &class
+		}
+
+		sort.SliceStable(report.Items, func(i, j int) bool {
+			return report.Items[i].Items_sold > report.Items[j].Items_sold
+		})
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func menuEngineeringClass(popular, profitable bool) string {
+	switch {
+	case popular && profitable:
+		return "star"
+	case popular:
+		return "plowhorse"
+	case profitable:
+		return "puzzle"
+	}
+	return "dog"
+}
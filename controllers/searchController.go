@@ -0,0 +1,389 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/models"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// menuMatchWeight scales down the score of foods found through their menu's
+// name or category, so foods matching by their own name rank first.
+const menuMatchWeight = 0.5
+
+// maxSearchResults caps how many foods and menus a search reads, best matches
+// first, before they are ranked and paged in memory.
+const maxSearchResults = 200
+
+type FoodSearchResult struct {
+	FoodView
+	Menu_name string  `json:"menu_name"`
+	Score     float64 `json:"score"`
+}
+
+type MenuSearchResult struct {
+	models.Menu `bson:",inline"`
+	Score       float64 `json:"score"`
+}
+
+// EnsureSearchIndexes creates the text indexes GET /search runs on. Mongo
+// allows one text index per collection, so these cover every searched field.
+func EnsureSearchIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := foodCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}, {Key: "category", Value: "text"}},
+		Options: options.Index().SetName("food_search").
+			SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "category", Value: 3}, {Key: "description", Value: 1}}),
+	})
+	if err != nil {
+		log.Println("could not create the food search index:", err)
+	}
+
+	_, err = menuCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: "text"}, {Key: "category", Value: "text"}},
+		Options: options.Index().SetName("menu_search").
+			SetWeights(bson.D{{Key: "name", Value: 5}, {Key: "category", Value: 3}}),
+	})
+	if err != nil {
+		log.Println("could not create the menu search index:", err)
+	}
+}
+
+// Search finds foods and menus matching q, ranked by text score. Foods match
+// on their own name, description and category, or through the name and
+// category of their menu. Foods can be narrowed with min_price, max_price,
+// category, menu_id, available and the allergen filters of GetFoods, and
+// sorted by relevance (the default), price_asc, price_desc or name. Foods are
+// paged with limit and cursor in the list envelope; since they are ranked in
+// memory, the cursor holds the offset of the next page.
+func Search() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		query := strings.TrimSpace(c.Query("q"))
+
+		limit, ok := listLimit(c)
+		if !ok {
+			return
+		}
+
+		sortBy := c.DefaultQuery("sort", "relevance")
+		if sortBy != "relevance" && sortBy != "price_asc" && sortBy != "price_desc" && sortBy != "name" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be relevance, price_asc, price_desc or name"})
+			return
+		}
+
+		start := 0
+		if value := c.Query("cursor"); value != "" {
+			offset, ok := searchOffset(value, sortBy)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cursor is invalid for this sort"})
+				return
+			}
+			start = offset
+		}
+
+		filter, ok := foodSearchFilter(c)
+		if !ok {
+			return
+		}
+
+		menus, err := searchMenus(ctx, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while searching menus"})
+			return
+		}
+
+		foods, err := searchFoods(ctx, query, filter, menus, sortBy)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while searching foods"})
+			return
+		}
+
+		if available := c.Query("available"); available != "" {
+			wanted := available == "true"
+			matching := []FoodSearchResult{}
+			for _, food := range foods {
+				if food.Available == wanted {
+					matching = append(matching, food)
+				}
+			}
+			foods = matching
+		}
+
+		sort.SliceStable(foods, func(i, j int) bool {
+			switch sortBy {
+			case "price_asc":
+				return foodPrice(foods[i].Food) < foodPrice(foods[j].Food)
+			case "price_desc":
+				return foodPrice(foods[i].Food) > foodPrice(foods[j].Food)
+			case "name":
+				return getStringValue(foods[i].Name) < getStringValue(foods[j].Name)
+			}
+			if foods[i].Score != foods[j].Score {
+				return foods[i].Score > foods[j].Score
+			}
+			return getStringValue(foods[i].Name) < getStringValue(foods[j].Name)
+		})
+
+		total := len(foods)
+		if start > total {
+			start = total
+		}
+		end := start + limit
+		var next *string
+		if end < total {
+			cursor := encodeListCursor(listCursor{Sort: sortBy, Value: int64(end)})
+			next = &cursor
+		} else {
+			end = total
+		}
+
+		menuResults := []MenuSearchResult{}
+		for _, menu := range menus {
+			menuResults = append(menuResults, menu)
+		}
+		sort.SliceStable(menuResults, func(i, j int) bool { return menuResults[i].Score > menuResults[j].Score })
+
+		c.JSON(http.StatusOK, gin.H{
+			"query":       query,
+			"data":        foods[start:end],
+			"next_cursor": next,
+			"total":       total,
+			"menus":       menuResults,
+		})
+	}
+}
+
+// searchOffset reads the offset out of a search cursor made for sortBy.
+func searchOffset(value, sortBy string) (int, bool) {
+	cursor, ok := decodeListCursor(value)
+	if !ok || cursor.Sort != sortBy {
+		return 0, false
+	}
+	offset, ok := cursor.Value.(int64)
+	if !ok || offset < 0 {
+		return 0, false
+	}
+	return int(offset), true
+}
+
+// foodSearchFilter builds the structured part of the food search, writing the
+// error response itself when a parameter is invalid.
+func foodSearchFilter(c *gin.Context) (bson.D, bool) {
+	filter, ok := foodTagFilter(c)
+	if !ok {
+		return nil, false
+	}
+	filter = append(filter, bson.E{Key: "deleted_at", Value: nil})
+
+	price := bson.D{}
+	if value := c.Query("min_price"); value != "" {
+		minPrice, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_price must be a number"})
+			return nil, false
+		}
+		price = append(price, bson.E{Key: "$gte", Value: minPrice})
+	}
+	if value := c.Query("max_price"); value != "" {
+		maxPrice, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_price must be a number"})
+			return nil, false
+		}
+		price = append(price, bson.E{Key: "$lte", Value: maxPrice})
+	}
+	if len(price) > 0 {
+		filter = append(filter, bson.E{Key: "price", Value: price})
+	}
+
+	if category := c.Query("category"); category != "" {
+		filter = append(filter, bson.E{Key: "category", Value: category})
+	}
+	if menuId := c.Query("menu_id"); menuId != "" {
+		filter = append(filter, bson.E{Key: "menu_id", Value: menuId})
+	}
+	if available := c.Query("available"); available != "" && available != "true" && available != "false" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "available must be true or false"})
+		return nil, false
+	}
+
+	return filter, true
+}
+
+// searchMenus returns the menus whose name or category match query, keyed by
+// id, with their text score.
+func searchMenus(ctx context.Context, query string) (map[string]MenuSearchResult, error) {
+	menus := map[string]MenuSearchResult{}
+	if query == "" {
+		return menus, nil
+	}
+
+	opts := textScoreOptions()
+	cursor, err := menuCollection.Find(ctx, bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}}, {Key: "deleted_at", Value: nil}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var results []MenuSearchResult
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		menus[result.Menu_id] = result
+	}
+	return menus, nil
+}
+
+// searchFoods runs the food search: foods matching query themselves, plus the
+// foods of the matching menus, merged with the best score of each. Without a
+// query it reads the first foods in sortBy order.
+func searchFoods(ctx context.Context, query string, filter bson.D, menus map[string]MenuSearchResult, sortBy string) ([]FoodSearchResult, error) {
+	scores := map[string]float64{}
+	found := map[string]models.Food{}
+
+	if query == "" {
+		order := bson.D{{Key: "name", Value: 1}}
+		switch sortBy {
+		case "price_asc":
+			order = bson.D{{Key: "price", Value: 1}}
+		case "price_desc":
+			order = bson.D{{Key: "price", Value: -1}}
+		}
+		opts := options.Find().SetSort(append(order, bson.E{Key: "_id", Value: 1})).SetLimit(maxSearchResults)
+		cursor, err := foodCollection.Find(ctx, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+		var foods []models.Food
+		if err = cursor.All(ctx, &foods); err != nil {
+			return nil, err
+		}
+		for _, food := range foods {
+			found[food.Food_id] = food
+		}
+	} else {
+		textFilter := append(bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}}}, filter...)
+		cursor, err := foodCollection.Find(ctx, textFilter, textScoreOptions())
+		if err != nil {
+			return nil, err
+		}
+		var results []struct {
+			models.Food `bson:",inline"`
+			Score       float64 `bson:"score"`
+		}
+		if err = cursor.All(ctx, &results); err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			found[result.Food_id] = result.Food
+			scores[result.Food_id] = result.Score
+		}
+
+		if len(menus) > 0 {
+			menuIds := []string{}
+			for menuId := range menus {
+				menuIds = append(menuIds, menuId)
+			}
+			menuFilter := append(bson.D{{Key: "menu_id", Value: bson.D{{Key: "$in", Value: menuIds}}}}, filter...)
+			cursor, err := foodCollection.Find(ctx, menuFilter, options.Find().SetLimit(maxSearchResults))
+			if err != nil {
+				return nil, err
+			}
+			var foods []models.Food
+			if err = cursor.All(ctx, &foods); err != nil {
+				return nil, err
+			}
+			for _, food := range foods {
+				score := menus[*food.Menu_id].Score * menuMatchWeight
+				if score > scores[food.Food_id] {
+					scores[food.Food_id] = score
+				}
+				found[food.Food_id] = food
+			}
+		}
+	}
+
+	foods := []models.Food{}
+	for _, food := range found {
+		foods = append(foods, food)
+	}
+	availability, err := foodAvailability(ctx, foods)
+	if err != nil {
+		return nil, err
+	}
+
+	menuNames, err := menuNamesFor(ctx, foods, menus)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []FoodSearchResult{}
+	for _, food := range foods {
+		results = append(results, FoodSearchResult{
+			FoodView:  FoodView{Food: food, FoodAvailability: availability[food.Food_id]},
+			Menu_name: menuNames[getStringValue(food.Menu_id)],
+			Score:     scores[food.Food_id],
+		})
+	}
+	return results, nil
+}
+
+// textScoreOptions reads the best maxSearchResults text matches with their
+// score.
+func textScoreOptions() *options.FindOptions {
+	score := bson.D{{Key: "$meta", Value: "textScore"}}
+	return options.Find().
+		SetProjection(bson.D{{Key: "score", Value: score}}).
+		SetSort(bson.D{{Key: "score", Value: score}}).
+		SetLimit(maxSearchResults)
+}
+
+func foodPrice(food models.Food) float64 {
+	if food.Price == nil {
+		return 0
+	}
+	return *food.Price
+}
+
+func menuNamesFor(ctx context.Context, foods []models.Food, known map[string]MenuSearchResult) (map[string]string, error) {
+	names := map[string]string{}
+	missing := []string{}
+	for _, food := range foods {
+		menuId := getStringValue(food.Menu_id)
+		if menu, found := known[menuId]; found {
+			names[menuId] = menu.Name
+		} else if _, found := names[menuId]; !found {
+			names[menuId] = ""
+			missing = append(missing, menuId)
+		}
+	}
+	if len(missing) == 0 {
+		return names, nil
+	}
+
+	cursor, err := menuCollection.Find(ctx, bson.M{"menu_id": bson.M{"$in": missing}})
+	if err != nil {
+		return nil, err
+	}
+	var menus []models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, err
+	}
+	for _, menu := range menus {
+		names[menu.Menu_id] = menu.Name
+	}
+	return names, nil
+}
@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var sectionCollection = database.OpenCollection(database.Client, "section")
+var sectionAssignmentCollection = database.OpenCollection(database.Client, "sectionAssignment")
+
+func GetSections() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, sectionCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"color": "string"},
+			Sorts:       []string{"name", "created_at", "updated_at"},
+			DefaultSort: "name",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		sectionId := c.Param("section_id")
+		var section models.Section
+
+		filter := bson.M{"section_id": sectionId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := sectionCollection.FindOne(ctx, filter).Decode(&section)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "section not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the section"})
+			return
+		}
+
+		setETag(c, section.Version)
+		c.JSON(http.StatusOK, section)
+	}
+}
+
+func CreateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var section models.Section
+
+		if err := c.BindJSON(&section); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(section); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now := time.Now()
+		section.ID = primitive.NewObjectID()
+		section.Section_id = section.ID.Hex()
+		section.Version = 1
+		section.Created_at = now
+		section.Updated_at = now
+
+		_, insertErr := sectionCollection.InsertOne(ctx, section)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section could not be created"})
+			return
+		}
+
+		setETag(c, section.Version)
+		c.JSON(http.StatusOK, section)
+	}
+}
+
+func UpdateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		sectionId := c.Param("section_id")
+		var section models.Section
+
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := c.BindJSON(&section); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		update := bson.D{}
+		if section.Name != "" {
+			update = append(update, bson.E{Key: "name", Value: section.Name})
+		}
+		if section.Color != "" {
+			update = append(update, bson.E{Key: "color", Value: section.Color})
+		}
+		update = append(update, bson.E{Key: "updated_at", Value: time.Now()})
+
+		filter := versionFilter("section_id", sectionId, version)
+		result, err := sectionCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}, bumpVersion})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section update failed"})
+			return
+		}
+
+		if result.MatchedCount == 1 {
+			var updatedSection models.Section
+			err := sectionCollection.FindOne(ctx, bson.M{"section_id": sectionId}).Decode(&updatedSection)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated section"})
+				return
+			}
+			setETag(c, updatedSection.Version)
+			c.JSON(http.StatusOK, updatedSection)
+			return
+		}
+
+		versionMismatch(ctx, c, sectionCollection, "section_id", sectionId, "section")
+	}
+}
+
+// GetSectionAssignments lists shift assignments, optionally narrowed to a
+// section, a user, or the shifts running at a given RFC3339 time.
+func GetSectionAssignments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if at := c.Query("at"); at != "" {
+			atTime, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC3339 timestamp"})
+				return
+			}
+			filter["shift_start"] = bson.M{"$lte": atTime}
+			filter["shift_end"] = bson.M{"$gt": atTime}
+		}
+
+		page, ok := listDocuments(ctx, c, sectionAssignmentCollection, filter, listQuery{
+			Filters:     map[string]string{"section_id": "string", "user_id": "string"},
+			Sorts:       []string{"shift_start", "shift_end", "created_at"},
+			DefaultSort: "shift_start",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func CreateSectionAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var assignment models.SectionAssignment
+		var section models.Section
+		var user models.User
+
+		if err := c.BindJSON(&assignment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(assignment); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if !assignment.Shift_end.After(*assignment.Shift_start) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "shift_end must be after shift_start"})
+			return
+		}
+
+		err := sectionCollection.FindOne(ctx, bson.M{"section_id": assignment.Section_id, "deleted_at": nil}).Decode(&section)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "section was not found"})
+			return
+		}
+
+		err = userCollection.FindOne(ctx, bson.M{"user_id": assignment.User_id, "deleted_at": nil}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user was not found"})
+			return
+		}
+
+		now := time.Now()
+		assignment.ID = primitive.NewObjectID()
+		assignment.Assignment_id = assignment.ID.Hex()
+		assignment.Created_at = now
+		assignment.Updated_at = now
+
+		_, insertErr := sectionAssignmentCollection.InsertOne(ctx, assignment)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section assignment could not be created"})
+			return
+		}
+
+		c.JSON(http.StatusOK, assignment)
+	}
+}
+
+// currentUserID returns the id the authentication middleware stored for the
+// logged-in user, or an empty string for anonymous requests.
+func currentUserID(c *gin.Context) string {
+	return c.GetString("uid")
+}
+
+// assignedSectionIDs returns the sections a user is working at the given time.
+func assignedSectionIDs(ctx context.Context, userId string, at time.Time) ([]string, error) {
+	cursor, err := sectionAssignmentCollection.Find(ctx, bson.M{
+		"user_id":     userId,
+		"shift_start": bson.M{"$lte": at},
+		"shift_end":   bson.M{"$gt": at},
+		"deleted_at":  nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []models.SectionAssignment
+	if err = cursor.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+
+	sectionIds := []string{}
+	for _, assignment := range assignments {
+		sectionIds = append(sectionIds, *assignment.Section_id)
+	}
+	return sectionIds, nil
+}
+
+// mySectionTableIDs resolves the ?mine=true filter to the tables sitting in the
+// logged-in waiter's current sections.
+func mySectionTableIDs(ctx context.Context, c *gin.Context) ([]string, error) {
+	sectionIds, err := assignedSectionIDs(ctx, currentUserID(c), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := tableCollection.Find(ctx, bson.M{"section_id": bson.M{"$in": sectionIds}, "deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []models.Table
+	if err = cursor.All(ctx, &tables); err != nil {
+		return nil, err
+	}
+
+	tableIds := []string{}
+	for _, table := range tables {
+		tableIds = append(tableIds, table.Table_id)
+	}
+	return tableIds, nil
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var supplierCollection = database.OpenCollection(database.Client, "supplier")
+var supplierPriceCollection = database.OpenCollection(database.Client, "supplierPrice")
+
+func GetSuppliers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, supplierCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"email": "string"},
+			Sorts:       []string{"name", "created_at", "updated_at"},
+			DefaultSort: "name",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		supplierId := c.Param("supplier_id")
+		var supplier models.Supplier
+
+		filter := bson.M{"supplier_id": supplierId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := supplierCollection.FindOne(ctx, filter).Decode(&supplier)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "supplier not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the supplier"})
+			return
+		}
+
+		setETag(c, supplier.Version)
+		c.JSON(http.StatusOK, supplier)
+	}
+}
+
+func CreateSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var supplier models.Supplier
+
+		if err := c.BindJSON(&supplier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(supplier); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now := time.Now()
+		supplier.ID = primitive.NewObjectID()
+		supplier.Supplier_id = supplier.ID.Hex()
+		supplier.Version = 1
+		supplier.Created_at = now
+		supplier.Updated_at = now
+
+		_, insertErr := supplierCollection.InsertOne(ctx, supplier)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "supplier could not be created"})
+			return
+		}
+
+		setETag(c, supplier.Version)
+		c.JSON(http.StatusOK, supplier)
+	}
+}
+
+func UpdateSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		supplierId := c.Param("supplier_id")
+		var supplier models.Supplier
+
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := c.BindJSON(&supplier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		update := bson.D{}
+		if supplier.Name != "" {
+			update = append(update, bson.E{Key: "name", Value: supplier.Name})
+		}
+		if supplier.Contact_name != "" {
+			update = append(update, bson.E{Key: "contact_name", Value: supplier.Contact_name})
+		}
+		if supplier.Email != "" {
+			if validationErr := validate.Var(supplier.Email, "email"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "email is not valid"})
+				return
+			}
+			update = append(update, bson.E{Key: "email", Value: supplier.Email})
+		}
+		if supplier.Phone != "" {
+			update = append(update, bson.E{Key: "phone", Value: supplier.Phone})
+		}
+		update = append(update, bson.E{Key: "updated_at", Value: time.Now()})
+
+		filter := versionFilter("supplier_id", supplierId, version)
+		result, err := supplierCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}, bumpVersion})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "supplier update failed"})
+			return
+		}
+
+		if result.MatchedCount == 1 {
+			var updatedSupplier models.Supplier
+			err := supplierCollection.FindOne(ctx, bson.M{"supplier_id": supplierId}).Decode(&updatedSupplier)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated supplier"})
+				return
+			}
+			setETag(c, updatedSupplier.Version)
+			c.JSON(http.StatusOK, updatedSupplier)
+			return
+		}
+
+		versionMismatch(ctx, c, supplierCollection, "supplier_id", supplierId, "supplier")
+	}
+}
+
+// GetSupplierPrices returns the price history of a supplier, newest first,
+// optionally for a single ingredient.
+func GetSupplierPrices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, supplierPriceCollection, bson.M{"supplier_id": c.Param("supplier_id")}, listQuery{
+			Filters:     map[string]string{"ingredient_id": "string", "purchase_order_id": "string", "recorded_at": "date"},
+			Sorts:       []string{"recorded_at", "unit_cost"},
+			DefaultSort: "-recorded_at",
+		})
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
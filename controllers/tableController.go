@@ -3,36 +3,46 @@ package controllers
 import (
 	"context"
 	"golang-restrogo/database"
+	"golang-restrogo/helper"
+	"golang-restrogo/helper/qrcode"
 	"golang-restrogo/models"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var tableCollection = database.OpenCollection(database.Client, "table")
 
+// openOrderStatuses are the order statuses that keep a table occupied.
+var openOrderStatuses = bson.A{"OPEN", "PENDING_CONFIRMATION"}
+
 func GetTables() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		cursor, err := tableCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while listing tables"})
+		filter, ok := tableFilter(ctx, c)
+		if !ok {
 			return
 		}
 
-		var tables []bson.M
-		if err = cursor.All(ctx, &tables); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		page, ok := listDocuments(ctx, c, tableCollection, filter, listQuery{
+			Filters:     map[string]string{"capacity": "int", "shape": "string"},
+			Sorts:       []string{"number", "capacity", "created_at", "updated_at"},
+			DefaultSort: "number",
+		})
+		if !ok {
 			return
 		}
-
-		c.JSON(http.StatusOK, tables)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -44,7 +54,11 @@ func GetTable() gin.HandlerFunc {
 		tableId := c.Param("table_id")
 		var table models.Table
 
-		err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table)
+		filter := bson.M{"table_id": tableId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := tableCollection.FindOne(ctx, filter).Decode(&table)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
@@ -54,6 +68,7 @@ func GetTable() gin.HandlerFunc {
 			return
 		}
 
+		setETag(c, table.Version)
 		c.JSON(http.StatusOK, table)
 	}
 }
@@ -75,9 +90,20 @@ func CreateTable() gin.HandlerFunc {
 			return
 		}
 
+		if table.Section_id != nil {
+			var section models.Section
+			err := sectionCollection.FindOne(ctx, bson.M{"section_id": table.Section_id, "deleted_at": nil}).Decode(&section)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "section was not found"})
+				return
+			}
+		}
+
 		now := time.Now()
 		table.ID = primitive.NewObjectID()
 		table.Table_id = table.ID.Hex()
+		table.Version = 1
+		table.Qr_token_version = 1
 		table.Created_at = now
 		table.Updated_at = now
 
@@ -86,7 +112,9 @@ func CreateTable() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "table could not be created"})
 			return
 		}
+		auditCreate(ctx, c, "tables", table.Table_id, table)
 
+		setETag(c, table.Version)
 		c.JSON(http.StatusOK, table)
 	}
 }
@@ -99,6 +127,10 @@ func UpdateTable() gin.HandlerFunc {
 		tableId := c.Param("table_id")
 		var table models.Table
 
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
 		if err := c.BindJSON(&table); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -111,26 +143,356 @@ func UpdateTable() gin.HandlerFunc {
 		if table.Capacity != 0 {
 			update = append(update, bson.E{Key: "capacity", Value: table.Capacity})
 		}
+		if table.Section_id != nil {
+			var section models.Section
+			err := sectionCollection.FindOne(ctx, bson.M{"section_id": table.Section_id, "deleted_at": nil}).Decode(&section)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "section was not found"})
+				return
+			}
+			update = append(update, bson.E{Key: "section_id", Value: table.Section_id})
+		}
+		if table.Position_x != nil {
+			update = append(update, bson.E{Key: "position_x", Value: table.Position_x})
+		}
+		if table.Position_y != nil {
+			update = append(update, bson.E{Key: "position_y", Value: table.Position_y})
+		}
+		if table.Shape != nil {
+			if validationErr := validate.Var(*table.Shape, "eq=ROUND|eq=SQUARE|eq=RECTANGLE"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "shape must be ROUND, SQUARE or RECTANGLE"})
+				return
+			}
+			update = append(update, bson.E{Key: "shape", Value: table.Shape})
+		}
 		update = append(update, bson.E{Key: "updated_at", Value: time.Now()})
 
-		filter := bson.M{"table_id": tableId}
-		result, err := tableCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}})
+		filter := versionFilter("table_id", tableId, version)
+		audit := beginAudit(ctx, "tables", tableId)
+		result, err := tableCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}, bumpVersion})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "table update failed"})
 			return
 		}
+		audit.record(ctx, c)
 
 		if result.MatchedCount == 1 {
 			var updatedTable models.Table
-			err := tableCollection.FindOne(ctx, filter).Decode(&updatedTable)
+			err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&updatedTable)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated table"})
 				return
 			}
+			setETag(c, updatedTable.Version)
 			c.JSON(http.StatusOK, updatedTable)
 			return
 		}
 
-		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		versionMismatch(ctx, c, tableCollection, "table_id", tableId, "table")
+	}
+}
+
+// guestOrderURL is where table QR codes point guests to; the table token is
+// appended to it.
+var guestOrderURL = os.Getenv("GUEST_ORDER_URL")
+
+// GetTableQRCode renders the QR code guests scan to order at a table, as a PNG
+// by default, or as SVG or JSON with the format query parameter.
+func GetTableQRCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if helper.TABLE_TOKEN_SECRET == "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table tokens are not configured"})
+			return
+		}
+
+		tableId := c.Param("table_id")
+		var table models.Table
+
+		err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the table"})
+			return
+		}
+
+		token := helper.GenerateTableToken(table.Table_id, table.Qr_token_version)
+		url := tableOrderURL(token)
+
+		format := c.DefaultQuery("format", "png")
+		if format == "json" {
+			c.JSON(http.StatusOK, gin.H{"table_id": table.Table_id, "qr_token_version": table.Qr_token_version, "token": token, "url": url})
+			return
+		}
+
+		scale, err := strconv.Atoi(c.DefaultQuery("scale", "8"))
+		if err != nil || scale < 1 || scale > 40 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scale must be between 1 and 40"})
+			return
+		}
+
+		code, err := qrcode.Encode(url)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the table QR code could not be generated"})
+			return
+		}
+
+		switch format {
+		case "png":
+			image, err := code.PNG(scale)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the table QR code could not be generated"})
+				return
+			}
+			c.Data(http.StatusOK, "image/png", image)
+		case "svg":
+			c.Data(http.StatusOK, "image/svg+xml", []byte(code.SVG(scale)))
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png, svg or json"})
+		}
 	}
 }
+
+// RotateTableQRToken retires the table's current QR code, e.g. after a
+// printed code was taken home, and returns the new token.
+func RotateTableQRToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if helper.TABLE_TOKEN_SECRET == "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table tokens are not configured"})
+			return
+		}
+
+		tableId := c.Param("table_id")
+		var table models.Table
+
+		audit := beginAudit(ctx, "tables", tableId)
+		err := tableCollection.FindOneAndUpdate(ctx,
+			bson.M{"table_id": tableId},
+			bson.D{
+				{Key: "$inc", Value: bson.D{{Key: "qr_token_version", Value: 1}, {Key: "version", Value: 1}}},
+				{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&table)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table QR token rotation failed"})
+			return
+		}
+		audit.record(ctx, c)
+
+		token := helper.GenerateTableToken(table.Table_id, table.Qr_token_version)
+		c.JSON(http.StatusOK, gin.H{"table_id": table.Table_id, "qr_token_version": table.Qr_token_version, "token": token, "url": tableOrderURL(token)})
+	}
+}
+
+func tableOrderURL(token string) string {
+	base := guestOrderURL
+	if base == "" {
+		base = "http://localhost:8000/guest/tables"
+	}
+	return strings.TrimRight(base, "/") + "/" + token
+}
+
+// TransferTable moves a party to another table: the orders still open at the
+// table, including those waiting for confirmation, move to to_table_id, which
+// must be free. The orders and both tables change in one transaction.
+func TransferTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tableId := c.Param("table_id")
+		var body struct {
+			To_table_id string `json:"to_table_id" validate:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to_table_id is required"})
+			return
+		}
+		if body.To_table_id == tableId {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the party is already at this table"})
+			return
+		}
+
+		openStatuses := bson.M{"$in": openOrderStatuses}
+		var orderIds []string
+		err := inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+			orderIds = []string{}
+			now := time.Now()
+
+			// Writing both tables first makes transfers to or from them at the
+			// same time conflict, so the new table stays free until commit.
+			for _, id := range []string{tableId, body.To_table_id} {
+				result, err := tableCollection.UpdateOne(sessionCtx,
+					bson.M{"table_id": id, "deleted_at": nil},
+					bson.D{{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}}, bumpVersion},
+				)
+				if err != nil {
+					return err
+				}
+				if result.MatchedCount == 0 {
+					return &abortError{http.StatusNotFound, "table " + id + " not found"}
+				}
+			}
+
+			occupied, err := orderCollection.CountDocuments(sessionCtx, bson.M{"table_id": body.To_table_id, "status": openStatuses, "deleted_at": nil})
+			if err != nil {
+				return err
+			}
+			if occupied > 0 {
+				return &abortError{http.StatusConflict, "the new table already has an open order"}
+			}
+
+			cursor, err := orderCollection.Find(sessionCtx, bson.M{"table_id": tableId, "status": openStatuses, "deleted_at": nil})
+			if err != nil {
+				return err
+			}
+			var orders []models.Order
+			if err = cursor.All(sessionCtx, &orders); err != nil {
+				return err
+			}
+			if len(orders) == 0 {
+				return &abortError{http.StatusConflict, "the table has no open order to move"}
+			}
+
+			for _, order := range orders {
+				audit := beginAudit(sessionCtx, "orders", order.Order_id)
+				_, err := orderCollection.UpdateOne(sessionCtx,
+					bson.M{"order_id": order.Order_id},
+					bson.D{{Key: "$set", Value: bson.D{
+						{Key: "table_id", Value: body.To_table_id},
+						{Key: "updated_at", Value: now},
+					}}, bumpVersion},
+				)
+				if err != nil {
+					return err
+				}
+				audit.record(sessionCtx, c)
+				orderIds = append(orderIds, order.Order_id)
+			}
+
+			// A party seated from the waitlist keeps pointing at its table.
+			_, err = waitlistCollection.UpdateMany(sessionCtx,
+				bson.M{"order_id": bson.M{"$in": orderIds}},
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "table_id", Value: body.To_table_id},
+					{Key: "updated_at", Value: now},
+				}}, bumpVersion},
+			)
+			return err
+		})
+		if err != nil {
+			rollbackResponse(c, err, "table transfer")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"from_table_id": tableId, "to_table_id": body.To_table_id, "order_ids": orderIds})
+	}
+}
+
+// GetFloorPlan returns every section with its tables laid out by position,
+// plus the tables that have not been placed in a section yet.
+func GetFloorPlan() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter, ok := tableFilter(ctx, c)
+		if !ok {
+			return
+		}
+		// Sections without tables are only left out when the tables are filtered.
+		filtered := len(filter) > 0
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+
+		cursor, err := tableCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while listing tables"})
+			return
+		}
+
+		var tables []models.Table
+		if err = cursor.All(ctx, &tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		cursor, err = sectionCollection.Find(ctx, bson.M{"deleted_at": nil})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while listing sections"})
+			return
+		}
+
+		var sections []models.Section
+		if err = cursor.All(ctx, &sections); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		tablesBySection := map[string][]models.Table{}
+		unassigned := []models.Table{}
+		for _, table := range tables {
+			if table.Section_id == nil {
+				unassigned = append(unassigned, table)
+				continue
+			}
+			tablesBySection[*table.Section_id] = append(tablesBySection[*table.Section_id], table)
+		}
+
+		floor := []gin.H{}
+		for _, section := range sections {
+			sectionTables, found := tablesBySection[section.Section_id]
+			if !found && filtered {
+				continue
+			}
+			if sectionTables == nil {
+				sectionTables = []models.Table{}
+			}
+			floor = append(floor, gin.H{"section": section, "tables": sectionTables})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sections": floor, "unassigned_tables": unassigned})
+	}
+}
+
+// tableFilter builds the table query from the section_id and mine query
+// parameters, writing the error response itself when it cannot.
+func tableFilter(ctx context.Context, c *gin.Context) (bson.M, bool) {
+	filter := bson.M{}
+	if sectionId := c.Query("section_id"); sectionId != "" {
+		filter["section_id"] = sectionId
+	}
+
+	if c.Query("mine") == "true" {
+		if currentUserID(c) == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "mine=true requires a logged-in user"})
+			return nil, false
+		}
+		tableIds, err := mySectionTableIDs(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while resolving your section"})
+			return nil, false
+		}
+		filter["table_id"] = bson.M{"$in": tableIds}
+	}
+
+	return filter, true
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"golang-restrogo/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// abortError ends a transaction because of the request rather than the
+// database, e.g. a table that is taken. It is answered with its own status.
+type abortError struct {
+	status  int
+	message string
+}
+
+func (err *abortError) Error() string {
+	return err.message
+}
+
+// inTransaction runs fn in a MongoDB transaction, so its writes are all kept
+// or all undone. fn may be run again when the transaction hits a transient
+// error, so it should not change anything outside the transaction.
+// Transactions need MongoDB to run as a replica set.
+func inTransaction(ctx context.Context, fn func(sessionCtx mongo.SessionContext) error) error {
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
+// rollbackResponse answers a request whose transaction failed. Nothing it
+// wrote was kept, which the response says with rolled_back.
+func rollbackResponse(c *gin.Context, err error, action string) {
+	var abort *abortError
+	if errors.As(err, &abort) {
+		c.JSON(abort.status, gin.H{"error": abort.message, "rolled_back": true})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": action + " failed and nothing was saved: " + err.Error(), "rolled_back": true})
+}
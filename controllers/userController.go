@@ -4,7 +4,9 @@ import (
 	"context"
 	"golang-restrogo/database"
 	"golang-restrogo/models"
+	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,19 +25,16 @@ func GetUsers() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		cursor, err := userCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while listing users"})
+		page, ok := listDocuments(ctx, c, userCollection, bson.M{}, listQuery{
+			Filters:     map[string]string{"email": "string", "phone": "string"},
+			Sorts:       []string{"first_name", "last_name", "email", "created_at"},
+			DefaultSort: "-created_at",
+			Projection:  bson.D{{Key: "password", Value: 0}, {Key: "token", Value: 0}, {Key: "refreshtoken", Value: 0}},
+		})
+		if !ok {
 			return
 		}
-
-		var users []bson.M
-		if err = cursor.All(ctx, &users); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		c.JSON(http.StatusOK, users)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -46,7 +46,11 @@ func GetUser() gin.HandlerFunc {
 		userId := c.Param("user_id")
 		var user models.User
 
-		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+		filter := bson.M{"user_id": userId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := userCollection.FindOne(ctx, filter).Decode(&user)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
@@ -56,6 +60,7 @@ func GetUser() gin.HandlerFunc {
 			return
 		}
 
+		setETag(c, user.Version)
 		c.JSON(http.StatusOK, user)
 	}
 }
@@ -88,12 +93,24 @@ func SignUp() gin.HandlerFunc {
 			return
 		}
 
+		// The first user runs the restaurant; everyone else starts as staff.
+		users, err := userCollection.CountDocuments(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error checking for existing user"})
+			return
+		}
+		user.Role = "STAFF"
+		if users == 0 {
+			user.Role = "ADMIN"
+		}
+
 		// Hash password
 		user.Password = HashPassword(user.Password)
 
 		now := time.Now()
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
+		user.Version = 1
 		user.Created_at = now
 		user.Updated_at = now
 		user.Token = ""
@@ -104,11 +121,153 @@ func SignUp() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "user could not be created"})
 			return
 		}
+		auditCreate(ctx, c, "users", user.User_id, user)
 
+		setETag(c, user.Version)
 		c.JSON(http.StatusOK, gin.H{"message": "user created successfully", "user_id": user.User_id})
 	}
 }
 
+// EnsureAdmin makes sure someone can manage roles, for users created before
+// roles existed. When no user is ADMIN it promotes the user whose email is
+// ADMIN_EMAIL, or the oldest user when that is not set.
+func EnsureAdmin() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{"role": "ADMIN", "deleted_at": nil})
+	if err != nil {
+		log.Println("could not look for an admin:", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	filter := bson.M{"deleted_at": nil}
+	if email := os.Getenv("ADMIN_EMAIL"); email != "" {
+		filter["email"] = email
+	}
+	var user models.User
+	err = userCollection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return
+	}
+	if err != nil {
+		log.Println("could not find a user to make admin:", err)
+		return
+	}
+
+	audit := beginAudit(ctx, "users", user.User_id)
+	_, err = userCollection.UpdateOne(ctx,
+		bson.M{"user_id": user.User_id},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "role", Value: "ADMIN"}, {Key: "updated_at", Value: time.Now()}}}, bumpVersion},
+	)
+	if err != nil {
+		log.Println("could not make", user.Email, "admin:", err)
+		return
+	}
+	audit.record(ctx, nil)
+	log.Println("no user was admin; made", user.Email, "admin")
+}
+
+// UpdateUserRole makes a user an ADMIN, a MANAGER or STAFF. Only admins can
+// change roles, and the last admin cannot be demoted.
+func UpdateUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if !requireRole(ctx, c, "ADMIN") {
+			return
+		}
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Role string `json:"role" validate:"eq=ADMIN|eq=MANAGER|eq=STAFF"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be ADMIN, MANAGER or STAFF"})
+			return
+		}
+
+		userId := c.Param("user_id")
+		if body.Role != "ADMIN" {
+			last, err := lastAdmin(ctx, userId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error while checking the admins"})
+				return
+			}
+			if last {
+				c.JSON(http.StatusConflict, gin.H{"error": "the last admin cannot be demoted; make someone else admin first"})
+				return
+			}
+		}
+
+		audit := beginAudit(ctx, "users", userId)
+		result, err := userCollection.UpdateOne(ctx,
+			versionFilter("user_id", userId, version),
+			bson.D{{Key: "$set", Value: bson.D{{Key: "role", Value: body.Role}, {Key: "updated_at", Value: time.Now()}}}, bumpVersion},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			versionMismatch(ctx, c, userCollection, "user_id", userId, "user")
+			return
+		}
+		audit.record(ctx, c)
+
+		setETag(c, version+1)
+		c.JSON(http.StatusOK, gin.H{"user_id": userId, "role": body.Role})
+	}
+}
+
+// requireRole checks that the signed in user has one of roles, writing the
+// error response itself when they do not.
+func requireRole(ctx context.Context, c *gin.Context, roles ...string) bool {
+	var user models.User
+	userId := currentUserID(c)
+	if userId == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sign in first"})
+		return false
+	}
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId, "deleted_at": nil}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "sign in first"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the user"})
+		return false
+	}
+	if !contains(roles, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this needs the role " + strings.Join(roles, " or ")})
+		return false
+	}
+	return true
+}
+
+// lastAdmin reports whether userId is the only live ADMIN left.
+func lastAdmin(ctx context.Context, userId string) (bool, error) {
+	count, err := userCollection.CountDocuments(ctx, bson.M{"user_id": userId, "role": "ADMIN", "deleted_at": nil})
+	if err != nil || count == 0 {
+		return false, err
+	}
+	count, err = userCollection.CountDocuments(ctx, bson.M{"role": "ADMIN", "deleted_at": nil})
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
 func Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
@@ -124,7 +283,7 @@ func Login() gin.HandlerFunc {
 		}
 
 		var user models.User
-		err := userCollection.FindOne(ctx, bson.M{"email": strings.ToLower(loginData.Email)}).Decode(&user)
+		err := userCollection.FindOne(ctx, bson.M{"email": strings.ToLower(loginData.Email), "deleted_at": nil}).Decode(&user)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
 			return
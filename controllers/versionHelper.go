@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Documents that can be updated carry a version, starting at 1 and going up
+// by one with every write. It is sent as the ETag of the document, and
+// updates must send it back in If-Match, so that two people editing the same
+// document cannot overwrite each other's changes. Documents written before
+// versions were kept count as version 0.
+
+// bumpVersion is the update operator that moves a document to its next
+// version. Every write to a versioned document includes it.
+var bumpVersion = bson.E{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}
+
+// setETag sends version as the ETag of the document in the response.
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatch reads the version the client is updating from the If-Match header.
+// It writes the error response itself when the header is missing or does not
+// hold a version.
+func ifMatch(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match is required; send the ETag of the document you are updating"})
+		return 0, false
+	}
+
+	value, err := strconv.Unquote(strings.TrimPrefix(header, "W/"))
+	if err != nil {
+		value = header
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match must be the ETag of the document"})
+		return 0, false
+	}
+	return version, true
+}
+
+// versionFilter matches the live document idField=id only while it is still
+// at version.
+func versionFilter(idField string, id interface{}, version int) bson.M {
+	filter := bson.M{idField: id, "deleted_at": nil, "version": version}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	return filter
+}
+
+// versionMismatch answers an update whose versionFilter matched nothing: 412
+// with the current ETag when the document has changed since the client read
+// it, or 404 when it does not exist.
+func versionMismatch(ctx context.Context, c *gin.Context, collection *mongo.Collection, idField string, id string, name string) {
+	var current struct {
+		Version int `bson:"version"`
+	}
+	err := collection.FindOne(ctx, bson.M{idField: id, "deleted_at": nil}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": name + " not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the " + name})
+		return
+	}
+
+	setETag(c, current.Version)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   name + " was changed by someone else; fetch it again and retry",
+		"version": current.Version,
+	})
+}
@@ -0,0 +1,523 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"golang-restrogo/database"
+	"golang-restrogo/models"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var waitlistCollection = database.OpenCollection(database.Client, "waitlist")
+
+// defaultTurnTime is the assumed table turn time until enough orders have
+// been closed to measure a real one.
+const defaultTurnTime = 60 * time.Minute
+
+type WaitlistEntryView struct {
+	models.WaitlistEntry
+	Position       int  `json:"position"`
+	Estimated_wait *int `json:"estimated_wait_minutes"`
+}
+
+type SeatWaitlistRequest struct {
+	Table_id *string `json:"table_id" validate:"required"`
+}
+
+// GetWaitlist lists the waiting parties, in queue order by default, see
+// listDocuments. Each carries its position and estimated wait in the whole
+// queue, not just the page.
+func GetWaitlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		page, ok := listDocuments(ctx, c, waitlistCollection, bson.M{"status": "WAITING"}, listQuery{
+			Filters:     map[string]string{"party_size": "int", "created_at": "date"},
+			Sorts:       []string{"created_at", "party_size"},
+			DefaultSort: "created_at",
+		})
+		if !ok {
+			return
+		}
+
+		entries, err := waitingEntries(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while listing the waitlist"})
+			return
+		}
+
+		views, err := waitlistViews(ctx, entries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while estimating wait times"})
+			return
+		}
+
+		byId := map[string]WaitlistEntryView{}
+		for _, view := range views {
+			byId[view.Waitlist_id] = view
+		}
+		for _, doc := range page.Data {
+			id, _ := doc["waitlist_id"].(string)
+			if view, found := byId[id]; found {
+				doc["position"] = view.Position
+				doc["estimated_wait_minutes"] = view.Estimated_wait
+			}
+		}
+
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		waitlistId := c.Param("waitlist_id")
+		var entry models.WaitlistEntry
+
+		filter := bson.M{"waitlist_id": waitlistId}
+		if !excludeDeleted(ctx, c, filter) {
+			return
+		}
+		err := waitlistCollection.FindOne(ctx, filter).Decode(&entry)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "waitlist entry not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while fetching the waitlist entry"})
+			return
+		}
+		setETag(c, entry.Version)
+
+		if entry.Status != "WAITING" || entry.Deleted_at != nil {
+			c.JSON(http.StatusOK, WaitlistEntryView{WaitlistEntry: entry})
+			return
+		}
+
+		view, err := waitlistEntryView(ctx, entry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while estimating wait time"})
+			return
+		}
+
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+func CreateWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var entry models.WaitlistEntry
+
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(entry); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now := time.Now()
+		entry.ID = primitive.NewObjectID()
+		entry.Waitlist_id = entry.ID.Hex()
+		entry.Version = 1
+		entry.Status = "WAITING"
+		entry.Table_id = nil
+		entry.Order_id = nil
+		entry.Seated_at = nil
+		entry.Created_at = now
+		entry.Updated_at = now
+
+		view, err := waitlistEntryView(ctx, entry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error while estimating wait time"})
+			return
+		}
+
+		// Quote the estimate unless the host already told the guest a time.
+		if entry.Quoted_minutes == nil {
+			entry.Quoted_minutes = view.Estimated_wait
+			view.Quoted_minutes = view.Estimated_wait
+		}
+
+		_, insertErr := waitlistCollection.InsertOne(ctx, entry)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "waitlist entry could not be created"})
+			return
+		}
+
+		setETag(c, entry.Version)
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+func UpdateWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		waitlistId := c.Param("waitlist_id")
+		var entry models.WaitlistEntry
+
+		version, ok := ifMatch(c)
+		if !ok {
+			return
+		}
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		update := bson.D{}
+		if entry.Party_name != "" {
+			update = append(update, bson.E{Key: "party_name", Value: entry.Party_name})
+		}
+		if entry.Party_size > 0 {
+			update = append(update, bson.E{Key: "party_size", Value: entry.Party_size})
+		}
+		if entry.Phone != "" {
+			update = append(update, bson.E{Key: "phone", Value: entry.Phone})
+		}
+		if entry.Quoted_minutes != nil {
+			update = append(update, bson.E{Key: "quoted_minutes", Value: entry.Quoted_minutes})
+		}
+		if entry.Status != "" {
+			// Seating goes through the seat endpoint so a table and order get attached.
+			if entry.Status != "CANCELLED" && entry.Status != "NO_SHOW" && entry.Status != "WAITING" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "status can only be changed to WAITING, CANCELLED or NO_SHOW"})
+				return
+			}
+			update = append(update, bson.E{Key: "status", Value: entry.Status})
+		}
+		update = append(update, bson.E{Key: "updated_at", Value: time.Now()})
+
+		filter := versionFilter("waitlist_id", waitlistId, version)
+		filter["status"] = bson.M{"$ne": "SEATED"}
+		result, err := waitlistCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: update}, bumpVersion})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "waitlist entry update failed"})
+			return
+		}
+
+		if result.MatchedCount == 1 {
+			var updatedEntry models.WaitlistEntry
+			err := waitlistCollection.FindOne(ctx, bson.M{"waitlist_id": waitlistId}).Decode(&updatedEntry)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch updated waitlist entry"})
+				return
+			}
+			setETag(c, updatedEntry.Version)
+			c.JSON(http.StatusOK, updatedEntry)
+			return
+		}
+
+		seated, err := waitlistCollection.CountDocuments(ctx, bson.M{"waitlist_id": waitlistId, "status": "SEATED", "deleted_at": nil})
+		if err == nil && seated > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "waitlist entry is already seated"})
+			return
+		}
+		versionMismatch(ctx, c, waitlistCollection, "waitlist_id", waitlistId, "waitlist entry")
+	}
+}
+
+// SeatWaitlistEntry seats a waiting party at a free table and opens an order
+// for it. Claiming the entry, checking the table and opening the order run in
+// one transaction.
+func SeatWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		waitlistId := c.Param("waitlist_id")
+		var request SeatWaitlistRequest
+		var entry models.WaitlistEntry
+		var table models.Table
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		err := waitlistCollection.FindOne(ctx, bson.M{"waitlist_id": waitlistId, "deleted_at": nil}).Decode(&entry)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "waitlist entry not found"})
+			return
+		}
+		if entry.Status != "WAITING" {
+			c.JSON(http.StatusConflict, gin.H{"error": "party is no longer waiting"})
+			return
+		}
+
+		err = tableCollection.FindOne(ctx, bson.M{"table_id": request.Table_id, "deleted_at": nil}).Decode(&table)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "table was not found"})
+			return
+		}
+		if table.Capacity < entry.Party_size {
+			msg := fmt.Sprintf("table %d seats %d, party has %d", table.Number, table.Capacity, entry.Party_size)
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		now := time.Now()
+		status := "OPEN"
+		order := models.Order{
+			ID:         primitive.NewObjectID(),
+			Table_id:   &table.Table_id,
+			Status:     &status,
+			Order_Date: now,
+			Created_at: now,
+			Updated_at: now,
+		}
+		order.Order_id = order.ID.Hex()
+		order.Version = 1
+		if userId := currentUserID(c); userId != "" {
+			order.Waiter_id = &userId
+		}
+
+		err = inTransaction(ctx, func(sessionCtx mongo.SessionContext) error {
+			// Writing the table first makes two seatings at it conflict, so it
+			// stays free until one of them commits.
+			result, err := tableCollection.UpdateOne(sessionCtx,
+				bson.M{"table_id": table.Table_id, "deleted_at": nil},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}}, bumpVersion},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return &abortError{http.StatusBadRequest, "table was not found"}
+			}
+
+			// Only a party still waiting can be claimed, so seating it twice
+			// opens one order.
+			result, err = waitlistCollection.UpdateOne(sessionCtx,
+				bson.M{"waitlist_id": waitlistId, "status": "WAITING", "deleted_at": nil},
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "status", Value: "SEATED"},
+					{Key: "table_id", Value: table.Table_id},
+					{Key: "order_id", Value: order.Order_id},
+					{Key: "seated_at", Value: now},
+					{Key: "updated_at", Value: now},
+				}}, bumpVersion},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return &abortError{http.StatusConflict, "party is no longer waiting"}
+			}
+
+			occupied, err := orderCollection.CountDocuments(sessionCtx, bson.M{"table_id": table.Table_id, "status": bson.M{"$in": openOrderStatuses}, "deleted_at": nil})
+			if err != nil {
+				return err
+			}
+			if occupied > 0 {
+				return &abortError{http.StatusConflict, "table is occupied"}
+			}
+
+			if _, err := orderCollection.InsertOne(sessionCtx, order); err != nil {
+				return err
+			}
+			auditCreate(sessionCtx, c, "orders", order.Order_id, order)
+			return nil
+		})
+		if err != nil {
+			rollbackResponse(c, err, "seating")
+			return
+		}
+
+		entry.Status = "SEATED"
+		entry.Table_id = &table.Table_id
+		entry.Order_id = &order.Order_id
+		entry.Seated_at = &now
+		entry.Updated_at = now
+		entry.Version++
+
+		c.JSON(http.StatusOK, gin.H{"waitlist_entry": entry, "order": order})
+	}
+}
+
+func waitingEntries(ctx context.Context) ([]models.WaitlistEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := waitlistCollection.Find(ctx, bson.M{"status": "WAITING", "deleted_at": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.WaitlistEntry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// waitlistEntryView positions a single entry against the parties waiting
+// ahead of it. New entries are not stored yet and land at the back.
+func waitlistEntryView(ctx context.Context, entry models.WaitlistEntry) (WaitlistEntryView, error) {
+	entries, err := waitingEntries(ctx)
+	if err != nil {
+		return WaitlistEntryView{}, err
+	}
+
+	queue := []models.WaitlistEntry{}
+	for _, waiting := range entries {
+		if waiting.Waitlist_id == entry.Waitlist_id {
+			break
+		}
+		queue = append(queue, waiting)
+	}
+	queue = append(queue, entry)
+
+	views, err := waitlistViews(ctx, queue)
+	if err != nil {
+		return WaitlistEntryView{}, err
+	}
+	return views[len(views)-1], nil
+}
+
+// waitlistViews assigns positions and estimated waits to parties in queue
+// order. Each party is matched to the earliest table big enough for it, and
+// that table is then assumed busy for another turn.
+func waitlistViews(ctx context.Context, entries []models.WaitlistEntry) ([]WaitlistEntryView, error) {
+	now := time.Now()
+
+	turnTime, err := averageTurnTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := tableReleaseTimes(ctx, now, turnTime)
+	if err != nil {
+		return nil, err
+	}
+
+	views := []WaitlistEntryView{}
+	for i, entry := range entries {
+		view := WaitlistEntryView{WaitlistEntry: entry, Position: i + 1}
+
+		best := -1
+		for j, release := range releases {
+			if release.capacity < entry.Party_size {
+				continue
+			}
+			if best == -1 || release.at.Before(releases[best].at) {
+				best = j
+			}
+		}
+
+		if best != -1 {
+			minutes := int(math.Ceil(releases[best].at.Sub(now).Minutes()))
+			view.Estimated_wait = &minutes
+			releases[best].at = releases[best].at.Add(turnTime)
+		}
+
+		views = append(views, view)
+	}
+
+	return views, nil
+}
+
+type tableRelease struct {
+	capacity int
+	at       time.Time
+}
+
+// tableReleaseTimes predicts when every table will next be free: now for
+// empty tables, otherwise when the open order reaches the average turn time.
+func tableReleaseTimes(ctx context.Context, now time.Time, turnTime time.Duration) ([]tableRelease, error) {
+	cursor, err := tableCollection.Find(ctx, bson.M{"deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []models.Table
+	if err = cursor.All(ctx, &tables); err != nil {
+		return nil, err
+	}
+
+	cursor, err = orderCollection.Find(ctx, bson.M{"status": bson.M{"$in": openOrderStatuses}, "deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	var openOrders []models.Order
+	if err = cursor.All(ctx, &openOrders); err != nil {
+		return nil, err
+	}
+
+	seatedAt := map[string]time.Time{}
+	for _, order := range openOrders {
+		if order.Table_id == nil {
+			continue
+		}
+		if seated, found := seatedAt[*order.Table_id]; !found || order.Order_Date.Before(seated) {
+			seatedAt[*order.Table_id] = order.Order_Date
+		}
+	}
+
+	releases := []tableRelease{}
+	for _, table := range tables {
+		release := now
+		if seated, found := seatedAt[table.Table_id]; found {
+			release = seated.Add(turnTime)
+			// A table running over the average is expected to free up shortly.
+			if release.Before(now) {
+				release = now.Add(5 * time.Minute)
+			}
+		}
+		releases = append(releases, tableRelease{capacity: table.Capacity, at: release})
+	}
+
+	return releases, nil
+}
+
+// averageTurnTime measures how long tables stayed occupied over the most
+// recently closed orders.
+func averageTurnTime(ctx context.Context) (time.Duration, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "closed_at", Value: -1}}).SetLimit(50)
+	cursor, err := orderCollection.Find(ctx, bson.M{"status": "CLOSED", "closed_at": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var orders []models.Order
+	if err = cursor.All(ctx, &orders); err != nil {
+		return 0, err
+	}
+
+	var total time.Duration
+	count := 0
+	for _, order := range orders {
+		if order.Closed_at == nil || order.Order_Date.IsZero() {
+			continue
+		}
+		total += order.Closed_at.Sub(order.Order_Date)
+		count++
+	}
+
+	if count == 0 {
+		return defaultTurnTime, nil
+	}
+	return total / time.Duration(count), nil
+}
@@ -0,0 +1,117 @@
+// Package export writes rows to CSV, XLSX or newline-delimited JSON as they
+// come, so exports of any size are streamed rather than built in memory.
+//
+// Cells may be nil, a string, a bool, an integer, a float64 or a time.Time.
+// Times are written in the location given to the writer.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Writer writes the rows of an export below its header.
+type Writer interface {
+	WriteRow(cells []interface{}) error
+	// Flush sends the rows written so far to the underlying writer.
+	Flush() error
+	// Close finishes the export; it does not close the underlying writer.
+	Close() error
+}
+
+// Format is a file format rows can be exported to.
+type Format struct {
+	ContentType string
+	Extension   string
+	New         func(w io.Writer, header []string, location *time.Location) (Writer, error)
+}
+
+var Formats = map[string]Format{
+	"csv":    {ContentType: "text/csv; charset=utf-8", Extension: "csv", New: NewCSV},
+	"xlsx":   {ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx", New: NewXLSX},
+	"ndjson": {ContentType: "application/x-ndjson", Extension: "ndjson", New: NewNDJSON},
+}
+
+type csvWriter struct {
+	csv      *csv.Writer
+	location *time.Location
+	record   []string
+}
+
+// NewCSV writes rows as CSV with a header line. Text starting with a
+// character a spreadsheet would read as a formula is prefixed with a quote.
+func NewCSV(w io.Writer, header []string, location *time.Location) (Writer, error) {
+	writer := &csvWriter{csv: csv.NewWriter(w), location: location, record: make([]string, len(header))}
+	if err := writer.csv.Write(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *csvWriter) WriteRow(cells []interface{}) error {
+	for i, cell := range cells {
+		switch value := cell.(type) {
+		case nil:
+			w.record[i] = ""
+		case string:
+			if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+				value = "'" + value
+			}
+			w.record[i] = value
+		case time.Time:
+			w.record[i] = value.In(w.location).Format(time.RFC3339)
+		default:
+			w.record[i] = fmt.Sprint(value)
+		}
+	}
+	return w.csv.Write(w.record[:len(cells)])
+}
+
+func (w *csvWriter) Flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func (w *csvWriter) Close() error {
+	return w.Flush()
+}
+
+type ndjsonWriter struct {
+	buffer   *bufio.Writer
+	encoder  *json.Encoder
+	header   []string
+	location *time.Location
+}
+
+// NewNDJSON writes each row as a JSON object on its own line, keyed by the
+// header.
+func NewNDJSON(w io.Writer, header []string, location *time.Location) (Writer, error) {
+	buffer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	return &ndjsonWriter{buffer: buffer, encoder: encoder, header: header, location: location}, nil
+}
+
+func (w *ndjsonWriter) WriteRow(cells []interface{}) error {
+	object := make(map[string]interface{}, len(cells))
+	for i, cell := range cells {
+		if value, ok := cell.(time.Time); ok {
+			cell = value.In(w.location).Format(time.RFC3339)
+		}
+		object[w.header[i]] = cell
+	}
+	return w.encoder.Encode(object)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.buffer.Flush()
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.Flush()
+}
@@ -0,0 +1,249 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLocation = time.FixedZone("UTC+2", 2*60*60)
+
+// testTime is 2024-05-01 10:30:00 in testLocation.
+var testTime = time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+
+func TestCSVRows(t *testing.T) {
+	tests := []struct {
+		name string
+		cell interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"text", "Margherita", "Margherita"},
+		{"comma and quotes", `tomato, "fresh" basil`, `tomato, "fresh" basil`},
+		{"newline", "line one\nline two", "line one\nline two"},
+		{"formula", "=SUM(A1:A9)", "'=SUM(A1:A9)"},
+		{"plus", "+1", "'+1"},
+		{"minus", "-1", "'-1"},
+		{"at", "@cmd", "'@cmd"},
+		{"tab", "\tx", "'\tx"},
+		{"carriage return", "\rx", "'\rx"},
+		{"formula character inside", "a=b", "a=b"},
+		{"bool", true, "true"},
+		{"int", 42, "42"},
+		{"int64", int64(-7), "-7"},
+		{"float", 12.5, "12.5"},
+		{"time", testTime, "2024-05-01T10:30:00+02:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			writer, err := NewCSV(&out, []string{"value", "next"}, testLocation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.WriteRow([]interface{}{test.cell, "end"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := csv.NewReader(&out).ReadAll()
+			if err != nil {
+				t.Fatalf("output is not valid CSV: %v", err)
+			}
+			want := [][]string{{"value", "next"}, {test.want, "end"}}
+			if !reflect.DeepEqual(records, want) {
+				t.Fatalf("got %q, want %q", records, want)
+			}
+		})
+	}
+}
+
+func TestNDJSONRows(t *testing.T) {
+	header := []string{"name", "price", "count", "available", "note", "created_at"}
+	rows := [][]interface{}{
+		{"Margherita <large>", 12.5, 3, true, nil, testTime},
+		{"Water", 2.0, int64(0), false, "=1+1", testTime.Add(time.Hour)},
+	}
+	want := []map[string]interface{}{
+		{"name": "Margherita <large>", "price": 12.5, "count": 3.0, "available": true, "note": nil, "created_at": "2024-05-01T10:30:00+02:00"},
+		{"name": "Water", "price": 2.0, "count": 0.0, "available": false, "note": "=1+1", "created_at": "2024-05-01T11:30:00+02:00"},
+	}
+
+	var out bytes.Buffer
+	writer, err := NewNDJSON(&out, header, testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i+1, err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Fatalf("line %d: got %v, want %v", i+1, got, want[i])
+		}
+	}
+	if strings.Contains(out.String(), `\u003c`) {
+		t.Fatal("HTML characters are escaped")
+	}
+}
+
+func TestExcelDate(t *testing.T) {
+	tests := []struct {
+		time time.Time
+		want float64
+	}{
+		{time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), 61},
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 45292},
+		{time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), 45292.5},
+		{time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC), 45292.75},
+		// Only the wall clock counts, not the offset.
+		{time.Date(2024, 1, 1, 6, 0, 0, 0, testLocation), 45292.25},
+	}
+
+	for _, test := range tests {
+		if got := excelDate(test.time); got != test.want {
+			t.Errorf("excelDate(%s) = %v, want %v", test.time, got, test.want)
+		}
+	}
+}
+
+// xlsxCell is a cell of the sheet XML, with its value either in v or, for
+// inline strings, in is/t.
+type xlsxCell struct {
+	Type  string `xml:"t,attr"`
+	Style string `xml:"s,attr"`
+	Value string `xml:"v"`
+	Text  string `xml:"is>t"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int        `xml:"r,attr"`
+		Cells  []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestXLSXWorkbook(t *testing.T) {
+	var out bytes.Buffer
+	writer, err := NewXLSX(&out, []string{"name", "price", "count", "available", "note", "created_at"}, testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{
+		{"Fish & Chips <large>", 12.5, 3, true, nil, testTime},
+		{"  padded  ", -0.25, int64(10), false, "=1+1", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("output is not a zip archive: %v", err)
+	}
+	parts := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[file.Name] = content
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		content, found := parts[name]
+		if !found {
+			t.Fatalf("workbook has no %s", name)
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s is not well-formed XML: %v", name, err)
+			}
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]xlsxCell{
+		{
+			{Type: "inlineStr", Style: "2", Text: "name"},
+			{Type: "inlineStr", Style: "2", Text: "price"},
+			{Type: "inlineStr", Style: "2", Text: "count"},
+			{Type: "inlineStr", Style: "2", Text: "available"},
+			{Type: "inlineStr", Style: "2", Text: "note"},
+			{Type: "inlineStr", Style: "2", Text: "created_at"},
+		},
+		{
+			{Type: "inlineStr", Text: "Fish & Chips <large>"},
+			{Value: "12.5"},
+			{Value: "3"},
+			{Type: "b", Value: "1"},
+			{},
+			// 2024-05-01 10:30 on the wall clock of testLocation.
+			{Style: "1", Value: "45413.4375"},
+		},
+		{
+			{Type: "inlineStr", Text: "  padded  "},
+			{Value: "-0.25"},
+			{Value: "10"},
+			{Type: "b", Value: "0"},
+			{Type: "inlineStr", Text: "=1+1"},
+			// 2024-01-01 12:00 on the wall clock of testLocation.
+			{Style: "1", Value: "45292.5"},
+		},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		if row.Number != i+1 {
+			t.Errorf("row %d is numbered %d", i+1, row.Number)
+		}
+		if !reflect.DeepEqual(row.Cells, want[i]) {
+			t.Errorf("row %d: got %+v, want %+v", i+1, row.Cells, want[i])
+		}
+	}
+}
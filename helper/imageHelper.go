@@ -0,0 +1,53 @@
+package helper
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail scales img down so that its longer side is at most maxSide,
+// averaging the source pixels behind each thumbnail pixel. Transparent areas
+// are flattened onto white, so the result can be saved as a JPEG. Images that
+// are already small enough are only flattened.
+func Thumbnail(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thumbWidth, thumbHeight := width, height
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			thumbWidth, thumbHeight = maxSide, max(1, height*maxSide/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*maxSide/height), maxSide
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for ty := 0; ty < thumbHeight; ty++ {
+		y0 := bounds.Min.Y + ty*height/thumbHeight
+		y1 := max(y0+1, bounds.Min.Y+(ty+1)*height/thumbHeight)
+		for tx := 0; tx < thumbWidth; tx++ {
+			x0 := bounds.Min.X + tx*width/thumbWidth
+			x1 := max(x0+1, bounds.Min.X+(tx+1)*width/thumbWidth)
+
+			var r, g, b, count uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(x, y).RGBA()
+					// Premultiplied colour over a white background.
+					r += uint64(pr + 0xffff - pa)
+					g += uint64(pg + 0xffff - pa)
+					b += uint64(pb + 0xffff - pa)
+					count++
+				}
+			}
+			thumb.SetRGBA(tx, ty, color.RGBA{
+				R: uint8((r / count) >> 8),
+				G: uint8((g / count) >> 8),
+				B: uint8((b / count) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return thumb
+}
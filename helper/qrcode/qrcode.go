@@ -0,0 +1,538 @@
+// Package qrcode encodes short text, such as the guest ordering URL of a
+// table, as a QR code and renders it to PNG or SVG.
+//
+// Only what the table codes need is supported: byte mode, error correction
+// level M and versions 1 to 10, which holds up to 213 bytes.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// ErrTooLong is returned when the content does not fit in a version 10 code.
+var ErrTooLong = errors.New("qrcode: content is too long")
+
+// quietZone is the light border, in modules, required around a code.
+const quietZone = 4
+
+// Code is an encoded QR code.
+type Code struct {
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+type blockLayout struct {
+	ecPerBlock int
+	group1     int
+	data1      int
+	group2     int
+	data2      int
+}
+
+// levelM holds the block structure of versions 1 to 10 at level M.
+var levelM = []blockLayout{
+	{10, 1, 16, 0, 0},
+	{16, 1, 28, 0, 0},
+	{26, 1, 44, 0, 0},
+	{18, 2, 32, 0, 0},
+	{24, 2, 43, 0, 0},
+	{16, 4, 27, 0, 0},
+	{18, 4, 31, 0, 0},
+	{22, 2, 38, 2, 39},
+	{22, 3, 36, 2, 37},
+	{26, 4, 43, 1, 44},
+}
+
+var alignmentPositions = [][]int{
+	{},
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+// Encode encodes content in the smallest version that fits it, with the mask
+// that scores the lowest penalty.
+func Encode(content string) (*Code, error) {
+	data := []byte(content)
+
+	version := 0
+	for v := 1; v <= len(levelM); v++ {
+		if 4+countBits(v)+8*len(data) <= 8*dataCodewords(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	codewords := addErrorCorrection(version, encodeData(version, data))
+
+	var best *Code
+	bestPenalty := 0
+	for mask := 0; mask < 8; mask++ {
+		code := newCode(version)
+		code.drawCodewords(codewords)
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		if penalty := code.penalty(); best == nil || penalty < bestPenalty {
+			best, bestPenalty = code, penalty
+		}
+	}
+	return best, nil
+}
+
+// Size is the number of modules on each side, without the quiet zone.
+func (code *Code) Size() int {
+	return code.size
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (code *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= code.size || y >= code.size {
+		return false
+	}
+	return code.modules[y][x]
+}
+
+// PNG renders the code with each module scale pixels wide, inside a quiet zone.
+func (code *Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (code.size + 2*quietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < code.size; y++ {
+		for x := 0; x < code.size; x++ {
+			if !code.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				offset := img.PixOffset((x+quietZone)*scale, (y+quietZone)*scale+dy)
+				for dx := 0; dx < scale; dx++ {
+					img.Pix[offset+dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as a single path, with each module scale units wide,
+// inside a quiet zone.
+func (code *Code) SVG(scale int) string {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (code.size + 2*quietZone) * scale
+
+	var path strings.Builder
+	for y := 0; y < code.size; y++ {
+		for x := 0; x < code.size; x++ {
+			if code.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh%dv%dh-%dz", (x+quietZone)*scale, (y+quietZone)*scale, scale, scale, scale)
+			}
+		}
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#ffffff"/>
+<path d="%s" fill="#000000"/>
+</svg>
+`, width, width, width, width, path.String())
+}
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func dataCodewords(version int) int {
+	layout := levelM[version-1]
+	return layout.group1*layout.data1 + layout.group2*layout.data2
+}
+
+// encodeData builds the data codewords: byte mode indicator, length, the
+// content, a terminator and pad bytes.
+func encodeData(version int, data []byte) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacity := 8 * dataCodewords(version)
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+// addErrorCorrection splits the data into blocks, computes the Reed-Solomon
+// codewords of each and interleaves the result.
+func addErrorCorrection(version int, data []byte) []byte {
+	layout := levelM[version-1]
+	divisor := reedSolomonDivisor(layout.ecPerBlock)
+
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for i := 0; i < layout.group1+layout.group2; i++ {
+		length := layout.data1
+		if i >= layout.group1 {
+			length = layout.data2
+		}
+		block := data[offset : offset+length]
+		offset += length
+		blocks = append(blocks, block)
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	result := []byte{}
+	for i := 0; i < layout.data1 || i < layout.data2; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, ecBlock := range ecBlocks {
+			result = append(result, ecBlock[i])
+		}
+	}
+	return result
+}
+
+func newCode(version int) *Code {
+	size := 17 + 4*version
+	code := &Code{size: size}
+	code.modules = make([][]bool, size)
+	code.isFunction = make([][]bool, size)
+	for y := range code.modules {
+		code.modules[y] = make([]bool, size)
+		code.isFunction[y] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		code.setFunction(6, i, i%2 == 0)
+		code.setFunction(i, 6, i%2 == 0)
+	}
+
+	code.drawFinder(3, 3)
+	code.drawFinder(size-4, 3)
+	code.drawFinder(3, size-4)
+
+	positions := alignmentPositions[version-1]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			code.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is known.
+	code.drawFormatBits(0)
+	if version >= 7 {
+		code.drawVersion(version)
+	}
+	return code
+}
+
+func (code *Code) setFunction(x, y int, dark bool) {
+	code.modules[y][x] = dark
+	code.isFunction[y][x] = true
+}
+
+// drawFinder draws a finder pattern centred on x, y with its separator.
+func (code *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= code.size || yy >= code.size {
+				continue
+			}
+			distance := max(abs(dx), abs(dy))
+			code.setFunction(xx, yy, distance != 2 && distance != 4)
+		}
+	}
+}
+
+func (code *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			code.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information, the error
+// correction level and mask protected by a BCH code, and the dark module.
+func (code *Code) drawFormatBits(mask int) {
+	const levelMBits = 0
+	data := levelMBits<<3 | mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		code.setFunction(8, i, bit(bits, i))
+	}
+	code.setFunction(8, 7, bit(bits, 6))
+	code.setFunction(8, 8, bit(bits, 7))
+	code.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		code.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		code.setFunction(code.size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		code.setFunction(8, code.size-15+i, bit(bits, i))
+	}
+	code.setFunction(8, code.size-8, true)
+}
+
+func (code *Code) drawVersion(version int) {
+	remainder := version
+	for i := 0; i < 12; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 11) * 0x1F25)
+	}
+	bits := version<<12 | remainder
+
+	for i := 0; i < 18; i++ {
+		a := code.size - 11 + i%3
+		b := i / 3
+		code.setFunction(a, b, bit(bits, i))
+		code.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order, two columns at a
+// time from the bottom right, skipping the function patterns.
+func (code *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := code.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < code.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if upward {
+					y = code.size - 1 - vert
+				}
+				if code.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				code.modules[y][x] = bit(int(codewords[i>>3]), 7-(i&7))
+				i++
+			}
+		}
+	}
+}
+
+func (code *Code) applyMask(mask int) {
+	for y := 0; y < code.size; y++ {
+		for x := 0; x < code.size; x++ {
+			if code.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				code.modules[y][x] = !code.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan, following the four rules of
+// the specification: long runs, 2x2 blocks, finder-like patterns and an
+// unbalanced ratio of dark modules.
+func (code *Code) penalty() int {
+	penalty := 0
+	for i := 0; i < code.size; i++ {
+		penalty += runPenalty(code.size, func(j int) bool { return code.modules[i][j] })
+		penalty += runPenalty(code.size, func(j int) bool { return code.modules[j][i] })
+	}
+
+	dark := 0
+	for y := 0; y < code.size; y++ {
+		for x := 0; x < code.size; x++ {
+			if code.modules[y][x] {
+				dark++
+			}
+			if x+1 < code.size && y+1 < code.size {
+				same := code.modules[y][x]
+				if code.modules[y][x+1] == same && code.modules[y+1][x] == same && code.modules[y+1][x+1] == same {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := code.size * code.size
+	penalty += abs(dark*100/total-50) / 5 * 10
+	return penalty
+}
+
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// runPenalty scores one row or column for runs of five or more modules of the
+// same colour and for patterns that look like a finder.
+func runPenalty(size int, dark func(int) bool) int {
+	penalty := 0
+	run := 1
+	for j := 1; j <= size; j++ {
+		if j < size && dark(j) == dark(j-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += 3 + run - 5
+		}
+		run = 1
+	}
+
+	for j := 0; j+len(finderLike[0]) <= size; j++ {
+		for _, pattern := range finderLike {
+			matches := true
+			for k, want := range pattern {
+				if dark(j+k) != want {
+					matches = false
+					break
+				}
+			}
+			if matches {
+				penalty += 40
+			}
+		}
+	}
+	return penalty
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree,
+// highest coefficient first with the leading 1 left out.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+type bitBuffer []bool
+
+func (buffer *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*buffer = append(*buffer, bit(value, i))
+	}
+}
+
+func (buffer bitBuffer) bytes() []byte {
+	result := make([]byte, len(buffer)/8)
+	for i, set := range buffer {
+		if set {
+			result[i>>3] |= 1 << uint(7-(i&7))
+		}
+	}
+	return result
+}
+
+func bit(value, i int) bool {
+	return (value>>uint(i))&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
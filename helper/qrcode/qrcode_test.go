@@ -0,0 +1,450 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// byteCapacityM is the number of bytes each version holds in byte mode at
+// level M, from the capacity table of ISO/IEC 18004.
+var byteCapacityM = []int{14, 26, 42, 62, 84, 106, 122, 152, 180, 213}
+
+// formatBitsM are the 15-bit format strings of level M for masks 0 to 7,
+// after BCH coding and masking with 101010000010010.
+var formatBitsM = []string{
+	"101010000010010",
+	"101000100100101",
+	"101111001111100",
+	"101101101001011",
+	"100010111111001",
+	"100000011001110",
+	"100111110010111",
+	"100101010100000",
+}
+
+// versionBits are the 18-bit version strings of versions 7 to 10.
+var versionBits = map[int]string{
+	7:  "000111110010010100",
+	8:  "001000010110111100",
+	9:  "001001101010011001",
+	10: "001010010011010011",
+}
+
+// blocksM is the error correction block structure of versions 1 to 10 at
+// level M: codewords per block, then the number of blocks and the data
+// codewords in each, for the two block groups.
+var blocksM = [][5]int{
+	{10, 1, 16, 0, 0},
+	{16, 1, 28, 0, 0},
+	{26, 1, 44, 0, 0},
+	{18, 2, 32, 0, 0},
+	{24, 2, 43, 0, 0},
+	{16, 4, 27, 0, 0},
+	{18, 4, 31, 0, 0},
+	{22, 2, 38, 2, 39},
+	{22, 3, 36, 2, 37},
+	{26, 4, 43, 1, 44},
+}
+
+// alignmentCenters are the alignment pattern positions of versions 1 to 10.
+var alignmentCenters = [][]int{
+	{},
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+func TestReedSolomonKnownCodewords(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ec   []byte
+	}{
+		{
+			// 1-M "01234567", the worked example of ISO/IEC 18004 annex I.
+			name: "01234567",
+			data: []byte{16, 32, 12, 86, 97, 128, 236, 17, 236, 17, 236, 17, 236, 17, 236, 17},
+			ec:   []byte{165, 36, 212, 193, 237, 54, 199, 135, 44, 85},
+		},
+		{
+			// 1-M "HELLO WORLD" in alphanumeric mode.
+			name: "HELLO WORLD",
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			ec:   []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+
+	for _, test := range tests {
+		got := reedSolomonRemainder(test.data, reedSolomonDivisor(len(test.ec)))
+		if !bytes.Equal(got, test.ec) {
+			t.Errorf("%s: error correction = %v, want %v", test.name, got, test.ec)
+		}
+	}
+}
+
+func TestEncodeDecodesAtEveryVersion(t *testing.T) {
+	for i, capacity := range byteCapacityM {
+		version := i + 1
+		for _, length := range []int{capacity, previousCapacity(i) + 1} {
+			content := testContent(length)
+			code, err := Encode(content)
+			if err != nil {
+				t.Fatalf("version %d, %d bytes: %v", version, length, err)
+			}
+			if want := 17 + 4*version; code.Size() != want {
+				t.Fatalf("version %d, %d bytes: size = %d, want %d", version, length, code.Size(), want)
+			}
+
+			decoded, err := decode(code, version)
+			if err != nil {
+				t.Fatalf("version %d, %d bytes: %v", version, length, err)
+			}
+			if decoded != content {
+				t.Fatalf("version %d, %d bytes: decoded %q, want %q", version, length, decoded, content)
+			}
+		}
+	}
+}
+
+// TestEveryMaskDecodes draws each version with every mask, not only the one
+// Encode would pick, so that all eight mask patterns are checked.
+func TestEveryMaskDecodes(t *testing.T) {
+	for i, capacity := range byteCapacityM {
+		version := i + 1
+		content := testContent(capacity)
+		codewords := addErrorCorrection(version, encodeData(version, []byte(content)))
+		for mask := 0; mask < 8; mask++ {
+			code := newCode(version)
+			code.drawCodewords(codewords)
+			code.applyMask(mask)
+			code.drawFormatBits(mask)
+
+			decoded, err := decode(code, version)
+			if err != nil {
+				t.Fatalf("version %d, mask %d: %v", version, mask, err)
+			}
+			if decoded != content {
+				t.Fatalf("version %d, mask %d: decoded %q, want %q", version, mask, decoded, content)
+			}
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(testContent(byteCapacityM[len(byteCapacityM)-1] + 1)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("err = %v, want ErrTooLong", err)
+	}
+}
+
+func previousCapacity(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return byteCapacityM[i-1]
+}
+
+// testContent is a table ordering URL padded to length bytes.
+func testContent(length int) string {
+	content := "https://restro.example/guest/tables/"
+	for i := 0; len(content) < length; i++ {
+		content += string("0123456789abcdef"[i*7%16])
+	}
+	return content[:length]
+}
+
+// decode reads code back the way a scanner does, independently of how Encode
+// drew it: it checks the function patterns and format information against
+// the specification, unmasks and reads the codewords, checks every block's
+// Reed-Solomon syndromes are zero and parses the byte mode segment.
+func decode(code *Code, version int) (string, error) {
+	size := code.Size()
+	reserved := functionModules(size, version)
+
+	for i := 8; i < size-8; i++ {
+		if code.Dark(i, 6) != (i%2 == 0) || code.Dark(6, i) != (i%2 == 0) {
+			return "", errors.New("timing pattern is wrong")
+		}
+	}
+	for _, corner := range [][2]int{{0, 0}, {size - 7, 0}, {0, size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if code.Dark(corner[0]+dx, corner[1]+dy) != (ring != 2) {
+					return "", errors.New("finder pattern is wrong")
+				}
+			}
+		}
+	}
+	if !code.Dark(8, size-8) {
+		return "", errors.New("dark module is missing")
+	}
+
+	// Both copies of the format string, most significant bit first.
+	var first, second strings.Builder
+	for _, x := range []int{0, 1, 2, 3, 4, 5, 7, 8} {
+		first.WriteString(moduleBit(code, x, 8))
+	}
+	for _, y := range []int{7, 5, 4, 3, 2, 1, 0} {
+		first.WriteString(moduleBit(code, 8, y))
+	}
+	for y := size - 1; y >= size-7; y-- {
+		second.WriteString(moduleBit(code, 8, y))
+	}
+	for x := size - 8; x < size; x++ {
+		second.WriteString(moduleBit(code, x, 8))
+	}
+	if first.String() != second.String() {
+		return "", errors.New("format copies differ")
+	}
+	mask := -1
+	for m, bits := range formatBitsM {
+		if bits == first.String() {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		return "", errors.New("format string " + first.String() + " is not a level M format")
+	}
+
+	if version >= 7 {
+		// Least significant bit first, down then across in the bottom left
+		// block, and across then down in the top right one.
+		want := versionBits[version]
+		for i := 0; i < 18; i++ {
+			bit := string(want[17-i])
+			if moduleBit(code, i/3, size-11+i%3) != bit || moduleBit(code, size-11+i%3, i/3) != bit {
+				return "", errors.New("version information is wrong")
+			}
+		}
+	}
+
+	// Read the data modules two columns at a time from the right, going up
+	// first, skipping the vertical timing pattern.
+	var bits []bool
+	upward := true
+	for right := size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for step := 0; step < size; step++ {
+			y := step
+			if upward {
+				y = size - 1 - step
+			}
+			for _, x := range []int{right, right - 1} {
+				if reserved[y][x] {
+					continue
+				}
+				bits = append(bits, code.Dark(x, y) != masked(mask, y, x))
+			}
+		}
+		upward = !upward
+	}
+
+	ecPerBlock, group1, data1, group2, data2 := blocksM[version-1][0], blocksM[version-1][1], blocksM[version-1][2], blocksM[version-1][3], blocksM[version-1][4]
+	blockCount := group1 + group2
+	total := group1*data1 + group2*data2 + blockCount*ecPerBlock
+	if len(bits)/8 < total {
+		return "", errors.New("too few data modules")
+	}
+	codewords := make([]byte, total)
+	for i := range codewords {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				codewords[i] |= 1 << uint(7-j)
+			}
+		}
+	}
+
+	// Undo the interleaving: data codewords go round the blocks, the longer
+	// blocks taking one more at the end, then the error correction does.
+	blocks := make([][]byte, blockCount)
+	next := 0
+	for i := 0; i < data1 || i < data2; i++ {
+		for b := range blocks {
+			length := data1
+			if b >= group1 {
+				length = data2
+			}
+			if i < length {
+				blocks[b] = append(blocks[b], codewords[next])
+				next++
+			}
+		}
+	}
+	data := []byte{}
+	for _, block := range blocks {
+		data = append(data, block...)
+	}
+	for i := 0; i < ecPerBlock; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[next])
+			next++
+		}
+	}
+	for b, block := range blocks {
+		if !syndromesZero(block, ecPerBlock) {
+			return "", errors.New("block " + string(rune('0'+b)) + " fails its Reed-Solomon check")
+		}
+	}
+
+	return parseByteMode(data, version)
+}
+
+// parseByteMode reads a single byte mode segment and checks the terminator
+// and pad codewords after it.
+func parseByteMode(data []byte, version int) (string, error) {
+	position := 0
+	read := func(length int) int {
+		value := 0
+		for i := 0; i < length; i++ {
+			value <<= 1
+			if position < len(data)*8 && data[position/8]&(0x80>>uint(position%8)) != 0 {
+				value |= 1
+			}
+			position++
+		}
+		return value
+	}
+
+	if read(4) != 0x4 {
+		return "", errors.New("segment is not in byte mode")
+	}
+	countLength := 8
+	if version >= 10 {
+		countLength = 16
+	}
+	length := read(countLength)
+	if position+8*length > len(data)*8 {
+		return "", errors.New("length runs past the data")
+	}
+	content := make([]byte, length)
+	for i := range content {
+		content[i] = byte(read(8))
+	}
+
+	terminator := min(4, len(data)*8-position)
+	if read(terminator) != 0 {
+		return "", errors.New("terminator is not zero")
+	}
+	if position%8 != 0 && read(8-position%8) != 0 {
+		return "", errors.New("padding bits are not zero")
+	}
+	for pad := byte(0xEC); position < len(data)*8; pad ^= 0xEC ^ 0x11 {
+		if byte(read(8)) != pad {
+			return "", errors.New("pad codewords are wrong")
+		}
+	}
+	return string(content), nil
+}
+
+// functionModules marks the modules that hold no data: finders with their
+// separators, timing patterns, alignment patterns, format and version
+// information and the dark module.
+func functionModules(size, version int) [][]bool {
+	reserved := make([][]bool, size)
+	for y := range reserved {
+		reserved[y] = make([]bool, size)
+	}
+	fill := func(x0, y0, width, height int) {
+		for y := y0; y < y0+height; y++ {
+			for x := x0; x < x0+width; x++ {
+				reserved[y][x] = true
+			}
+		}
+	}
+
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+
+	centers := alignmentCenters[version-1]
+	for _, x := range centers {
+		for _, y := range centers {
+			inFinder := (x < 9 || x >= size-8) && (y < 9 || y >= size-8) && !(x >= size-8 && y >= size-8)
+			if inFinder {
+				continue
+			}
+			fill(x-2, y-2, 5, 5)
+		}
+	}
+
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return reserved
+}
+
+// masked is the mask pattern condition at row i, column j.
+func masked(mask, i, j int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// syndromesZero evaluates the block, read as a polynomial, at the first ec
+// powers of the generator, which all vanish for a valid codeword.
+func syndromesZero(block []byte, ec int) bool {
+	var exp [512]byte
+	var log [256]int
+	value := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(value)
+		log[value] = i
+		value <<= 1
+		if value&0x100 != 0 {
+			value ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+
+	for i := 0; i < ec; i++ {
+		syndrome := byte(0)
+		for _, c := range block {
+			// Horner's rule: syndrome = syndrome*alpha^i + c.
+			if syndrome != 0 {
+				syndrome = exp[log[syndrome]+i]
+			}
+			syndrome ^= c
+		}
+		if syndrome != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func moduleBit(code *Code, x, y int) string {
+	if code.Dark(x, y) {
+		return "1"
+	}
+	return "0"
+}
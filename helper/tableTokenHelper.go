@@ -0,0 +1,49 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var TABLE_TOKEN_SECRET string = os.Getenv("TABLE_TOKEN_SECRET")
+
+// GenerateTableToken signs the id and token version of a table for its QR
+// code. Rotating a table bumps its version, which retires the old codes.
+func GenerateTableToken(tableId string, version int) string {
+	payload := tableId + "." + strconv.Itoa(version)
+	return payload + "." + tableTokenSignature(payload)
+}
+
+// ValidateTableToken checks the signature of a table token and returns the
+// table id and token version it carries, or an error message.
+func ValidateTableToken(token string) (tableId string, version int, msg string) {
+	if TABLE_TOKEN_SECRET == "" {
+		return "", 0, "table tokens are not configured"
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", 0, "the table token is malformed"
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(tableTokenSignature(payload))) {
+		return "", 0, "the table token is invalid"
+	}
+
+	version, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, "the table token is malformed"
+	}
+	return parts[0], version, ""
+}
+
+func tableTokenSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(TABLE_TOKEN_SECRET))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
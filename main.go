@@ -1,10 +1,13 @@
 package main
 
 import (
+	controller "golang-restrogo/controllers"
 	"golang-restrogo/database"
 	"golang-restrogo/middleware"
 	"golang-restrogo/routes"
+	"golang-restrogo/storage"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,17 +22,41 @@ func main() {
 		port = "8000"
 	}
 
+	controller.EnsureSearchIndexes()
+	controller.EnsureImportIndexes()
+	controller.EnsureAdmin()
+	middleware.EnsureIdempotencyIndexes()
+
 	router := gin.New()
 	router.Use(gin.Logger())
 	routes.UserRoutes(router)
+	routes.PublicRoutes(router)
+	routes.GuestRoutes(router)
+	if local, ok := storage.Store.(*storage.LocalStore); ok && strings.HasPrefix(local.URLPrefix, "/") {
+		router.Static(local.URLPrefix, local.Dir)
+	}
 	router.Use(middleware.Authentication())
 
+	routes.UserAdminRoutes(router)
 	routes.FoodRoutes(router)
 	routes.MenuRoutes(router)
+	routes.ComboRoutes(router)
+	routes.IngredientRoutes(router)
+	routes.RecipeRoutes(router)
+	routes.SupplierRoutes(router)
+	routes.PurchaseOrderRoutes(router)
 	routes.TableRoutes(router)
+	routes.SectionRoutes(router)
+	routes.WaitlistRoutes(router)
 	routes.OrderRoutes(router)
 	routes.OrderItemRoutes(router)
 	routes.InvoiceRoutes(router)
+	routes.DrawerRoutes(router)
+	routes.SearchRoutes(router)
+	routes.ReportRoutes(router)
+	routes.ExportRoutes(router)
+	routes.ImportRoutes(router)
+	routes.AuditRoutes(router)
 
 	router.Run(":" + port)
 }
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"golang-restrogo/database"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var idempotencyCollection = database.OpenCollection(database.Client, "idempotencyKey")
+
+// How long a key is remembered, and how long a request may hold its key
+// before a retry is allowed to take it over.
+const idempotencyTTL = 24 * time.Hour
+const idempotencyLockTimeout = 2 * time.Minute
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRecord is a request made with an Idempotency-Key, and once it
+// has finished, the response it got. Keys belong to the user who sent them
+// and to the route they were sent to.
+type idempotencyRecord struct {
+	Key          string            `bson:"key"`
+	User_id      string            `bson:"user_id"`
+	Path         string            `bson:"path"`
+	Request_hash string            `bson:"request_hash"`
+	Status       int               `bson:"status"`
+	Headers      map[string]string `bson:"headers"`
+	Body         []byte            `bson:"body"`
+	Completed_at *time.Time        `bson:"completed_at"`
+	Created_at   time.Time         `bson:"created_at"`
+}
+
+// replayedHeaders are the response headers stored and sent again with the
+// body.
+var replayedHeaders = []string{"Content-Type", "ETag"}
+
+// EnsureIdempotencyIndexes makes each key unique per user and route, and lets
+// MongoDB drop keys once they are older than idempotencyTTL.
+func EnsureIdempotencyIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := idempotencyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}, {Key: "user_id", Value: 1}, {Key: "path", Value: 1}},
+			Options: options.Index().SetName("key_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("created_at_ttl").SetExpireAfterSeconds(int32(idempotencyTTL.Seconds())),
+		},
+	})
+	if err != nil {
+		log.Println("could not create the idempotency key indexes:", err)
+	}
+}
+
+// Idempotency makes a create route safe to retry. A request sent with an
+// Idempotency-Key header runs once; retries with the same key and the same
+// body get the original response again, with Idempotent-Replayed: true.
+// Reusing a key for a different request is refused with 422, and a retry
+// that arrives while the first request is still running gets 409. Responses
+// with a 5xx status are not kept, so the request can be retried. Requests
+// without the header are handled as usual.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "request body could not be read"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		record := idempotencyRecord{
+			Key:          key,
+			User_id:      c.GetString("uid"),
+			Path:         c.Request.URL.Path,
+			Request_hash: hex.EncodeToString(hash.Sum(nil)),
+			Created_at:   time.Now(),
+		}
+		if !claimIdempotencyKey(ctx, c, record) {
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		filter := bson.M{"key": record.Key, "user_id": record.User_id, "path": record.Path}
+		if writer.Status() >= http.StatusInternalServerError {
+			if _, err := idempotencyCollection.DeleteOne(ctx, filter); err != nil {
+				log.Println("could not release idempotency key", key, ":", err)
+			}
+			return
+		}
+
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := writer.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		now := time.Now()
+		_, err = idempotencyCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: writer.Status()},
+			{Key: "headers", Value: headers},
+			{Key: "body", Value: writer.body.Bytes()},
+			{Key: "completed_at", Value: now},
+		}}})
+		if err != nil {
+			log.Println("could not store the response for idempotency key", key, ":", err)
+		}
+	}
+}
+
+// claimIdempotencyKey records the key before the request runs, so that only
+// one request with it gets through. When the key is already taken it answers
+// the request itself, with the stored response or an error, and returns
+// false.
+func claimIdempotencyKey(ctx context.Context, c *gin.Context, record idempotencyRecord) bool {
+	_, err := idempotencyCollection.InsertOne(ctx, record)
+	if err == nil {
+		return true
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "error while checking the Idempotency-Key"})
+		return false
+	}
+
+	filter := bson.M{"key": record.Key, "user_id": record.User_id, "path": record.Path}
+	var existing idempotencyRecord
+	if err := idempotencyCollection.FindOne(ctx, filter).Decode(&existing); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "error while checking the Idempotency-Key"})
+		return false
+	}
+
+	if existing.Request_hash != record.Request_hash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return false
+	}
+
+	if existing.Completed_at == nil {
+		// The first request may have died without releasing the key; once it
+		// has held the key longer than any request runs, take it over.
+		filter["completed_at"] = nil
+		filter["created_at"] = bson.M{"$lt": time.Now().Add(-idempotencyLockTimeout)}
+		result, err := idempotencyCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "created_at", Value: record.Created_at}}}})
+		if err == nil && result.ModifiedCount == 1 {
+			return true
+		}
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still being processed"})
+		return false
+	}
+
+	for name, value := range existing.Headers {
+		c.Header(name, value)
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(existing.Status, existing.Headers["Content-Type"], existing.Body)
+	c.Abort()
+	return false
+}
+
+// recordingWriter keeps a copy of the response body as it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
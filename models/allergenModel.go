@@ -0,0 +1,25 @@
+package models
+
+// Allergens are the 14 allergens EU law requires restaurants to declare.
+var Allergens = []string{
+	"celery",
+	"gluten",
+	"crustaceans",
+	"eggs",
+	"fish",
+	"lupin",
+	"milk",
+	"molluscs",
+	"mustard",
+	"nuts",
+	"peanuts",
+	"sesame",
+	"soya",
+	"sulphites",
+}
+
+var Dietary_tags = []string{
+	"vegan",
+	"vegetarian",
+	"halal",
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEntry records a document being created or updated: who did it, from
+// where, and which fields changed. Actor_id is empty for guests and for
+// changes the system makes on its own.
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Audit_id   string             `json:"audit_id"`
+	Entity     string             `json:"entity"`
+	Entity_id  string             `json:"entity_id"`
+	Action     string             `json:"action"`
+	Actor_id   *string            `json:"actor_id"`
+	Ip         string             `json:"ip"`
+	Changes    []FieldChange      `json:"changes"`
+	Created_at time.Time          `json:"created_at"`
+}
+
+// FieldChange is the value of a top-level field before and after a change.
+// Before is null for created documents and for fields that were added.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BusinessDay is a closed trading day. Once it exists, the invoices created
+// that day can no longer be changed, and Z_report keeps the figures as they
+// were at close.
+type BusinessDay struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Business_date string             `json:"business_date"`
+	Closed_by     string             `json:"closed_by"`
+	Closed_at     time.Time          `json:"closed_at"`
+	Z_report      DayReport          `json:"z_report"`
+}
+
+// DayReport summarises the invoices of a business day by payment method and
+// status, and the cash drawers worked that day.
+type DayReport struct {
+	Business_date string               `json:"business_date"`
+	Generated_at  time.Time            `json:"generated_at"`
+	Invoices      []InvoiceSummaryLine `json:"invoices"`
+	Totals        InvoiceSummaryLine   `json:"totals"`
+	Drawers       []DrawerSession      `json:"drawers"`
+}
+
+type InvoiceSummaryLine struct {
+	Payment_method *string `json:"payment_method"`
+	Payment_status *string `json:"payment_status"`
+	Count          int     `json:"count"`
+	Subtotal       float64 `json:"subtotal"`
+	Discount       float64 `json:"discount"`
+	Tax            float64 `json:"tax"`
+	Total          float64 `json:"total"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Combo is a bundle of foods sold at a single price, e.g. burger, fries and
+// a drink. Each slot is filled with its default food or one of the allowed
+// substitutions.
+type Combo struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Combo_id   string             `json:"combo_id"`
+	Name       string             `json:"name" validate:"required,min=2,max=100"`
+	Price      *float64           `json:"price" validate:"required,gt=0"`
+	Menu_id    *string            `json:"menu_id"`
+	Slots      []ComboSlot        `json:"slots" validate:"required,min=1,dive"`
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+	Version    int                `json:"version"`
+	Deleted_at *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+}
+
+type ComboSlot struct {
+	Slot_id          string   `json:"slot_id"`
+	Name             string   `json:"name" validate:"required"`
+	Default_food_id  string   `json:"default_food_id" validate:"required"`
+	Allowed_food_ids []string `json:"allowed_food_ids"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DrawerSession is a cashier's shift on a cash drawer, from the opening float
+// to the counted cash at close. Expected_cash and Variance are set on close;
+// a negative variance means cash is missing.
+type DrawerSession struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Drawer_session_id string             `json:"drawer_session_id"`
+	Cashier_id        string             `json:"cashier_id"`
+	Business_date     string             `json:"business_date"`
+	Status            string             `json:"status" validate:"omitempty,eq=OPEN|eq=CLOSED"`
+	Opening_float     *float64           `json:"opening_float" validate:"required,gte=0"`
+	Movements         []CashMovement     `json:"movements"`
+	Counted_cash      *float64           `json:"counted_cash"`
+	Expected_cash     *float64           `json:"expected_cash"`
+	Variance          *float64           `json:"variance"`
+	Opened_at         time.Time          `json:"opened_at"`
+	Closed_at         *time.Time         `json:"closed_at"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+}
+
+// CashMovement is cash put into (IN) or taken out of (OUT) a drawer other than
+// through a sale, such as a change top-up or a safe drop.
+type CashMovement struct {
+	Movement_id string    `json:"movement_id"`
+	Type        string    `json:"type" validate:"required,eq=IN|eq=OUT"`
+	Amount      float64   `json:"amount" validate:"required,gt=0"`
+	Reason      string    `json:"reason" validate:"required,max=200"`
+	Created_by  string    `json:"created_by"`
+	Created_at  time.Time `json:"created_at"`
+}
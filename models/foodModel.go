@@ -7,12 +7,45 @@ import (
 )
 
 type Food struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Name       *string            `json:"name" validate:"required,min=2,max=100"`
-	Price      *float64           `json:"price" validate:"required"`
-	Food_image *string            `json:"food_image" validate:"required"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Food_id    string             `json:"food_id"`
-	Menu_id    *string            `json:"menu_id" validate:"required"`
+	ID               primitive.ObjectID `bson:"_id"`
+	Name             *string            `json:"name" validate:"required,min=2,max=100"`
+	Price            *float64           `json:"price" validate:"required"`
+	Cost             *float64           `json:"cost" validate:"omitempty,gte=0"`
+	Description      *string            `json:"description" validate:"omitempty,max=1000"`
+	Food_image       *string            `json:"food_image" validate:"omitempty,food_image"`
+	Food_thumbnail   *string            `json:"food_thumbnail"`
+	Image_keys       []string           `json:"-"`
+	Category         *string            `json:"category"`
+	Sort_order       *int               `json:"sort_order"`
+	Is_available     *bool              `json:"is_available"`
+	Allergens        []string           `json:"allergens" validate:"omitempty,dive,allergen"`
+	Dietary_tags     []string           `json:"dietary_tags" validate:"omitempty,dive,dietary_tag"`
+	Tags_from_recipe *bool              `json:"tags_from_recipe"`
+	Modifier_groups  []ModifierGroup    `json:"modifier_groups" validate:"omitempty,dive"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Version          int                `json:"version"`
+	Deleted_at       *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by       *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+	Food_id          string             `json:"food_id"`
+	Menu_id          *string            `json:"menu_id" validate:"required"`
+	Sku              *string            `json:"sku" validate:"omitempty,max=64"`
+}
+
+// ModifierGroup is a set of options a guest picks from when ordering a food,
+// such as its size, extras or cooking temperature. A Max_selections of 0
+// means there is no upper limit.
+type ModifierGroup struct {
+	Group_id       string           `json:"group_id"`
+	Name           string           `json:"name" validate:"required"`
+	Required       bool             `json:"required"`
+	Min_selections int              `json:"min_selections" validate:"gte=0"`
+	Max_selections int              `json:"max_selections" validate:"gte=0"`
+	Options        []ModifierOption `json:"options" validate:"required,min=1,dive"`
+}
+
+type ModifierOption struct {
+	Option_id   string  `json:"option_id"`
+	Name        string  `json:"name" validate:"required"`
+	Price_delta float64 `json:"price_delta"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Ingredient struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	Ingredient_id    string             `json:"ingredient_id"`
+	Name             string             `json:"name" validate:"required,min=2,max=100"`
+	Unit             string             `json:"unit" validate:"required,eq=g|eq=kg|eq=ml|eq=l|eq=pcs"`
+	Stock_quantity   *float64           `json:"stock_quantity" validate:"required"`
+	Reorder_level    *float64           `json:"reorder_level" validate:"omitempty,gte=0"`
+	Reorder_quantity *float64           `json:"reorder_quantity" validate:"omitempty,gt=0"`
+	Supplier_id      *string            `json:"supplier_id"`
+	Unit_cost        *float64           `json:"unit_cost" validate:"omitempty,gte=0"`
+	Allergens        []string           `json:"allergens" validate:"omitempty,dive,allergen"`
+	Dietary_tags     []string           `json:"dietary_tags" validate:"omitempty,dive,dietary_tag"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Version          int                `json:"version"`
+	Deleted_at       *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by       *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+}
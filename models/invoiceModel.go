@@ -6,13 +6,26 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Invoice settles an order. Subtotal is the sum of its live order items,
+// Discount an amount taken off it, and Tax is charged on what remains, so
+// Total = Subtotal - Discount + Tax. Cash payments are taken into the drawer
+// session of the cashier who records them.
 type Invoice struct {
-	ID               primitive.ObjectID `bson:"_id"`
-	Invoice_id       string             `json:"invoice_id"`
-	Order_id         string             `json:"order_id"`
-	Payment_method   *string            `json:"payment_method" validate:"omitempty,eq=CARD|eq=CASH"`
-	Payment_status   *string            `json:"payment_status" validate:"required,eq=PENDING|eq=PAID"`
-	Payment_due_date time.Time          `json:"payment_due_date"`
-	Created_at       time.Time          `json:"created_at"`
-	Updated_at       time.Time          `json:"updated_at"`
+	ID                primitive.ObjectID `bson:"_id"`
+	Invoice_id        string             `json:"invoice_id"`
+	Order_id          string             `json:"order_id"`
+	Payment_method    *string            `json:"payment_method" validate:"omitempty,eq=CARD|eq=CASH"`
+	Payment_status    *string            `json:"payment_status" validate:"required,eq=PENDING|eq=PAID"`
+	Payment_due_date  time.Time          `json:"payment_due_date"`
+	Subtotal          float64            `json:"subtotal"`
+	Discount          *float64           `json:"discount" validate:"omitempty,gte=0"`
+	Tax               float64            `json:"tax"`
+	Total             float64            `json:"total"`
+	Paid_at           *time.Time         `json:"paid_at"`
+	Drawer_session_id *string            `json:"drawer_session_id"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+	Version           int                `json:"version"`
+	Deleted_at        *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by        *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
 }
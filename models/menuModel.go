@@ -7,12 +7,26 @@ import (
 )
 
 type Menu struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Name       string             `json:"name" validate:"required"`
-	Category   string             `json:"category" validate:"required"`
-	Start_Date *time.Time         `json:"start_date"`
-	End_Date   *time.Time         `json:"end_date"`
-	Created_at *time.Time         `json:"created_at"`
-	Updated_at *time.Time         `json:"updated_at"`
-	Menu_id    string             `json:"food_id"`
+	ID             primitive.ObjectID `bson:"_id"`
+	Name           string             `json:"name" validate:"required"`
+	Category       string             `json:"category" validate:"required"`
+	Start_Date     *time.Time         `json:"start_date"`
+	End_Date       *time.Time         `json:"end_date"`
+	Dayparts       []Daypart          `json:"dayparts" validate:"omitempty,dive"`
+	Category_order []string           `json:"category_order"`
+	Created_at     *time.Time         `json:"created_at"`
+	Updated_at     *time.Time         `json:"updated_at"`
+	Version        int                `json:"version"`
+	Deleted_at     *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by     *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+	Menu_id        string             `json:"food_id"`
+	Sku            *string            `json:"sku" validate:"omitempty,max=64"`
+}
+
+// Daypart is a recurring window in which a menu is served, e.g. breakfast
+// from 07:00 to 11:00 on weekdays. Times are HH:MM in the server's time zone.
+type Daypart struct {
+	Days       []string `json:"days" validate:"required,min=1,dive,eq=MON|eq=TUE|eq=WED|eq=THU|eq=FRI|eq=SAT|eq=SUN"`
+	Start_time string   `json:"start_time" validate:"required"`
+	End_time   string   `json:"end_time" validate:"required"`
 }
@@ -8,11 +8,39 @@ import (
 
 type OrderItem struct {
 	ID          primitive.ObjectID `bson:"_id"`
-	Quantity    *int               `json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
-	UnitPrice   *float64           `json:"unit_price" validate:"required"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
-	FoodID      *string            `json:"food_id" validate:"required"`
-	OrderItemID string             `json:"order_item_id"`
-	OrderID     string             `json:"order_id" validate:"required"`
+	Quantity    *int               `bson:"quantity" json:"quantity" validate:"required,min=1"`
+	UnitPrice   *float64           `bson:"unit_price" json:"unit_price"`
+	Modifiers   []SelectedModifier `bson:"modifiers" json:"modifiers" validate:"omitempty,dive"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	Version     int                `bson:"version" json:"version"`
+	DeletedAt   *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	DeletedBy   *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+	VoidedAt    *time.Time         `bson:"voided_at" json:"voided_at"`
+	FoodID      *string            `bson:"food_id" json:"food_id" validate:"required_without=ComboID"`
+	ComboID     *string            `bson:"combo_id" json:"combo_id"`
+	Components  []ComboComponent   `bson:"components" json:"components" validate:"omitempty,dive"`
+	OrderItemID string             `bson:"order_item_id" json:"order_item_id"`
+	OrderID     string             `bson:"order_id" json:"order_id" validate:"required"`
+}
+
+// SelectedModifier is a modifier option chosen for an order item. The name
+// and price delta are copied from the food when the item is priced, so later
+// menu changes don't rewrite what was sold.
+type SelectedModifier struct {
+	GroupID    string  `bson:"group_id" json:"group_id" validate:"required"`
+	OptionID   string  `bson:"option_id" json:"option_id" validate:"required"`
+	Name       string  `bson:"name" json:"name"`
+	PriceDelta float64 `bson:"price_delta" json:"price_delta"`
+}
+
+// ComboComponent is the food serving one slot of a combo order item. Slots
+// left out of the request get the slot's default food. AllocatedPrice is this
+// component's share of the combo's unit price, split in proportion to the
+// foods' own prices, so reports can attribute combo revenue to each food.
+type ComboComponent struct {
+	SlotID         string  `bson:"slot_id" json:"slot_id" validate:"required"`
+	FoodID         string  `bson:"food_id" json:"food_id" validate:"required"`
+	Name           string  `bson:"name" json:"name"`
+	AllocatedPrice float64 `bson:"allocated_price" json:"allocated_price"`
 }
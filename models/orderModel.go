@@ -6,11 +6,23 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Order statuses: OPEN while the table is being served and CLOSED once paid.
+// Orders placed by guests through a table QR code start as
+// PENDING_CONFIRMATION until a waiter confirms them, or REJECTED.
 type Order struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty"`
-	Order_id   string             `json:"order_id"`
-	Table_id   *string            `json:"table_id" validate:"required"`
-	Order_Date time.Time          `json:"ordered_date"`
-	Updated_at time.Time          `json:"updated_at"`
-	Created_at time.Time          `json:"created_at"`
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Order_id    string             `json:"order_id"`
+	Table_id    *string            `json:"table_id" validate:"required"`
+	Status      *string            `json:"status" validate:"omitempty,eq=OPEN|eq=CLOSED"`
+	Source      *string            `json:"source"`
+	Waiter_id   *string            `json:"waiter_id"`
+	Order_Date  time.Time          `json:"ordered_date"`
+	Reviewed_by *string            `json:"reviewed_by"`
+	Reviewed_at *time.Time         `json:"reviewed_at"`
+	Closed_at   *time.Time         `json:"closed_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Version     int                `json:"version"`
+	Deleted_at  *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by  *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+	Created_at  time.Time          `json:"created_at"`
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PurchaseOrder struct {
+	ID                primitive.ObjectID  `bson:"_id,omitempty"`
+	Purchase_order_id string              `json:"purchase_order_id"`
+	Supplier_id       *string             `json:"supplier_id" validate:"required"`
+	Status            string              `json:"status" validate:"omitempty,eq=DRAFT|eq=ORDERED|eq=PARTIALLY_RECEIVED|eq=RECEIVED|eq=CANCELLED"`
+	Lines             []PurchaseOrderLine `json:"lines" validate:"required,min=1,dive"`
+	Ordered_at        *time.Time          `json:"ordered_at"`
+	Received_at       *time.Time          `json:"received_at"`
+	Created_at        time.Time           `json:"created_at"`
+	Updated_at        time.Time           `json:"updated_at"`
+	Version           int                 `json:"version"`
+	Deleted_at        *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by        *string             `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+}
+
+type PurchaseOrderLine struct {
+	Ingredient_id     string   `json:"ingredient_id" validate:"required"`
+	Quantity          float64  `json:"quantity" validate:"required,gt=0"`
+	Unit_cost         *float64 `json:"unit_cost" validate:"omitempty,gte=0"`
+	Received_quantity float64  `json:"received_quantity"`
+}
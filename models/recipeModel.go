@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Recipe struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Recipe_id   string             `json:"recipe_id"`
+	Food_id     *string            `json:"food_id" validate:"required"`
+	Ingredients []RecipeIngredient `json:"ingredients" validate:"required,min=1,dive"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Version     int                `json:"version"`
+}
+
+// RecipeIngredient is the amount of an ingredient, in the ingredient's own
+// unit, that goes into one portion of the food.
+type RecipeIngredient struct {
+	Ingredient_id string  `json:"ingredient_id" validate:"required"`
+	Quantity      float64 `json:"quantity" validate:"required,gt=0"`
+}
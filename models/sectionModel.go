@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Section struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Section_id string             `json:"section_id"`
+	Name       string             `json:"name" validate:"required,min=2,max=100"`
+	Color      string             `json:"color"`
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+	Version    int                `json:"version"`
+	Deleted_at *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+}
+
+type SectionAssignment struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Assignment_id string             `json:"assignment_id"`
+	Section_id    *string            `json:"section_id" validate:"required"`
+	User_id       *string            `json:"user_id" validate:"required"`
+	Shift_start   *time.Time         `json:"shift_start" validate:"required"`
+	Shift_end     *time.Time         `json:"shift_end" validate:"required"`
+	Created_at    time.Time          `json:"created_at"`
+	Updated_at    time.Time          `json:"updated_at"`
+	Deleted_at    *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by    *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+}
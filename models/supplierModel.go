@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Supplier struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Supplier_id  string             `json:"supplier_id"`
+	Name         string             `json:"name" validate:"required,min=2,max=100"`
+	Contact_name string             `json:"contact_name"`
+	Email        string             `json:"email" validate:"omitempty,email"`
+	Phone        string             `json:"phone"`
+	Created_at   time.Time          `json:"created_at"`
+	Updated_at   time.Time          `json:"updated_at"`
+	Version      int                `json:"version"`
+	Deleted_at   *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by   *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+}
+
+// SupplierPrice records what a supplier charged per unit of an ingredient on
+// a delivery, building the price history used for food-cost reporting.
+type SupplierPrice struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Supplier_id       string             `json:"supplier_id"`
+	Ingredient_id     string             `json:"ingredient_id"`
+	Purchase_order_id string             `json:"purchase_order_id"`
+	Quantity          float64            `json:"quantity"`
+	Unit_cost         float64            `json:"unit_cost"`
+	Recorded_at       time.Time          `json:"recorded_at"`
+}
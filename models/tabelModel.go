@@ -7,10 +7,18 @@ import (
 )
 
 type Table struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty"`
-	Table_id   string             `json:"table_id"`
-	Number     int                `json:"number" validate:"required"`
-	Capacity   int                `json:"capacity" validate:"required"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	Table_id         string             `json:"table_id"`
+	Number           int                `json:"number" validate:"required"`
+	Capacity         int                `json:"capacity" validate:"required"`
+	Section_id       *string            `json:"section_id"`
+	Position_x       *float64           `json:"position_x"`
+	Position_y       *float64           `json:"position_y"`
+	Shape            *string            `json:"shape" validate:"omitempty,eq=ROUND|eq=SQUARE|eq=RECTANGLE"`
+	Qr_token_version int                `json:"qr_token_version"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Version          int                `json:"version"`
+	Deleted_at       *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by       *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
 }
@@ -6,6 +6,9 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User is a member of staff. Role is ADMIN, MANAGER or STAFF; the first user
+// to sign up is the ADMIN and everyone after starts as STAFF. At startup, if
+// no user is ADMIN, ADMIN_EMAIL or else the oldest user is promoted.
 type User struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty"`
 	User_id      string             `json:"user_id"`
@@ -16,6 +19,10 @@ type User struct {
 	Phone        string             `json:"phone" validate:"required"`
 	Token        string             `json:"token"`
 	RefreshToken string             `json:"refresh_token"`
+	Role         string             `json:"role"`
 	Created_at   time.Time          `json:"created_at"`
 	Updated_at   time.Time          `json:"updated_at"`
+	Version      int                `json:"version"`
+	Deleted_at   *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by   *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
 }
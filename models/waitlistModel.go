@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WaitlistEntry struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Waitlist_id    string             `json:"waitlist_id"`
+	Party_name     string             `json:"party_name" validate:"required,min=1,max=100"`
+	Party_size     int                `json:"party_size" validate:"required,min=1"`
+	Phone          string             `json:"phone" validate:"required"`
+	Quoted_minutes *int               `json:"quoted_minutes" validate:"omitempty,min=0"`
+	Status         string             `json:"status" validate:"omitempty,eq=WAITING|eq=SEATED|eq=CANCELLED|eq=NO_SHOW"`
+	Table_id       *string            `json:"table_id"`
+	Order_id       *string            `json:"order_id"`
+	Seated_at      *time.Time         `json:"seated_at"`
+	Created_at     time.Time          `json:"created_at"`
+	Updated_at     time.Time          `json:"updated_at"`
+	Version        int                `json:"version"`
+	Deleted_at     *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty" validate:"isdefault"`
+	Deleted_by     *string            `bson:"deleted_by,omitempty" json:"deleted_by,omitempty" validate:"isdefault"`
+}
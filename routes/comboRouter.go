@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func ComboRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/combos", controller.GetCombos())
+	incomingRoutes.GET("/combos/:combo_id", controller.GetCombo())
+	incomingRoutes.POST("/combos", controller.CreateCombo())
+	incomingRoutes.PATCH("/combos/:combo_id", controller.UpdateCombo())
+	incomingRoutes.DELETE("/combos/:combo_id", controller.DeleteDocument("combos"))
+	incomingRoutes.POST("/combos/:combo_id/restore", controller.RestoreDocument("combos"))
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func DrawerRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/drawers", controller.GetDrawers())
+	incomingRoutes.GET("/drawers/:drawer_session_id", controller.GetDrawer())
+	incomingRoutes.POST("/drawers", controller.OpenDrawer())
+	incomingRoutes.POST("/drawers/:drawer_session_id/movements", controller.AddCashMovement())
+	incomingRoutes.POST("/drawers/:drawer_session_id/close", controller.CloseDrawer())
+	incomingRoutes.GET("/businessDays", controller.GetBusinessDays())
+	incomingRoutes.GET("/businessDays/:business_date", controller.GetBusinessDay())
+	incomingRoutes.GET("/businessDays/:business_date/x-report", controller.GetXReport())
+	incomingRoutes.POST("/businessDays/:business_date/close", controller.CloseBusinessDay())
+}
@@ -0,0 +1,10 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func ExportRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/exports/:entity", controller.Export())
+}
@@ -8,6 +8,11 @@ import (
 func FoodRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/foods", controller.GetFoods())
 	incomingRoutes.GET("/foods/:food_id", controller.GetFood())
+	incomingRoutes.GET("/foods/:food_id/cost", controller.GetFoodCost())
 	incomingRoutes.POST("/foods", controller.CreateFood())
-	incomingRoutes.POST("/users/login", controller.UpdateFood())
+	incomingRoutes.PATCH("/foods/:food_id", controller.UpdateFood())
+	incomingRoutes.POST("/foods/:food_id/image", controller.UploadFoodImage())
+	incomingRoutes.DELETE("/foods/:food_id", controller.DeleteDocument("foods"))
+	incomingRoutes.POST("/foods/:food_id/restore", controller.RestoreDocument("foods"))
+	incomingRoutes.GET("/allergens", controller.GetAllergens())
 }
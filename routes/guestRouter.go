@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+	"golang-restrogo/middleware"
+)
+
+// GuestRoutes are reached from the table QR codes and are authorised by the
+// signed table token instead of a staff login.
+func GuestRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/guest/tables/:token", controller.GetGuestTable())
+	incomingRoutes.POST("/guest/tables/:token/orders", middleware.Idempotency(), controller.CreateGuestOrder())
+}
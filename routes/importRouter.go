@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func ImportRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/imports/foods", controller.ImportFoods())
+	incomingRoutes.POST("/imports/menus", controller.ImportMenus())
+}
@@ -3,11 +3,14 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	controller "golang-restrogo/controllers"
+	"golang-restrogo/middleware"
 )
 
 func InvoiceRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/invoices", controller.GetInvoices())
 	incomingRoutes.GET("/invoices/:invoice_id", controller.GetInvoice())
-	incomingRoutes.POST("/invoices", controller.CreateInvoice())
+	incomingRoutes.POST("/invoices", middleware.Idempotency(), controller.CreateInvoice())
 	incomingRoutes.PATCH("/invoices/:invoice_id", controller.UpdateInvoice())
+	incomingRoutes.DELETE("/invoices/:invoice_id", controller.DeleteDocument("invoices"))
+	incomingRoutes.POST("/invoices/:invoice_id/restore", controller.RestoreDocument("invoices"))
 }
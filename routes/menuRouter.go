@@ -7,7 +7,12 @@ import (
 
 func MenuRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/menus", controller.GetMenus())
+	incomingRoutes.GET("/menus/active", controller.GetActiveMenus())
 	incomingRoutes.GET("/menus/:menu_id", controller.GetMenu())
 	incomingRoutes.POST("/menus", controller.CreateMenu())
 	incomingRoutes.PATCH("/menus/:menu_id", controller.UpdateMenu())
+	incomingRoutes.DELETE("/menus/:menu_id", controller.DeleteDocument("menus"))
+	incomingRoutes.POST("/menus/:menu_id/restore", controller.RestoreDocument("menus"))
+	incomingRoutes.GET("/menus/:menu_id/foods", controller.GetMenuFoods())
+	incomingRoutes.GET("/menus/:menu_id/full", controller.GetFullMenu())
 }
@@ -3,12 +3,17 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	controller "golang-restrogo/controllers"
+	"golang-restrogo/middleware"
 )
 
 func OrderItemRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orderItems", controller.GetOrderItems())
 	incomingRoutes.GET("/orderItems/:orderItem_id", controller.GetOrderItem())
 	incomingRoutes.GET("/orderItems-order/:order_id", controller.GetOrderItemsByOrder())
-	incomingRoutes.POST("/orderItems", controller.CreateOrderItem())
+	incomingRoutes.POST("/orderItems", middleware.Idempotency(), controller.CreateOrderItem())
 	incomingRoutes.PATCH("/orderItems/:orderItem_id", controller.UpdateOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/void", controller.VoidOrderItem())
+	incomingRoutes.DELETE("/orderItems/:orderItem_id", controller.DeleteDocument("orderItems"))
+	incomingRoutes.POST("/orderItems/:orderItem_id/restore", controller.RestoreDocument("orderItems"))
+	incomingRoutes.GET("/kitchenTickets/:order_id", controller.GetKitchenTickets())
 }
@@ -3,11 +3,16 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	controller "golang-restrogo/controllers"
+	"golang-restrogo/middleware"
 )
 
 func OrderRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orders", controller.GetOrders())
 	incomingRoutes.GET("/orders/:order_id", controller.GetOrder())
-	incomingRoutes.POST("/orders", controller.CreateOrder())
+	incomingRoutes.POST("/orders", middleware.Idempotency(), controller.CreateOrder())
 	incomingRoutes.POST("/orders/:order_id", controller.UpdateOrder())
+	incomingRoutes.POST("/orders/:order_id/confirm", controller.ConfirmOrder())
+	incomingRoutes.POST("/orders/:order_id/reject", controller.RejectOrder())
+	incomingRoutes.DELETE("/orders/:order_id", controller.DeleteDocument("orders"))
+	incomingRoutes.POST("/orders/:order_id/restore", controller.RestoreDocument("orders"))
 }
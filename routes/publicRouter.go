@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+// PublicRoutes are served without authentication, for guests.
+func PublicRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/public/menus", controller.GetPublicMenus())
+	incomingRoutes.GET("/public/menus/:menu_id/full", controller.GetPublicFullMenu())
+	incomingRoutes.GET("/public/foods", controller.GetPublicFoods())
+}
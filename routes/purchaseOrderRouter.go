@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func PurchaseOrderRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/purchaseOrders", controller.GetPurchaseOrders())
+	incomingRoutes.GET("/purchaseOrders/:purchase_order_id", controller.GetPurchaseOrder())
+	incomingRoutes.POST("/purchaseOrders", controller.CreatePurchaseOrder())
+	incomingRoutes.PATCH("/purchaseOrders/:purchase_order_id", controller.UpdatePurchaseOrder())
+	incomingRoutes.POST("/purchaseOrders/:purchase_order_id/receive", controller.ReceivePurchaseOrder())
+	incomingRoutes.DELETE("/purchaseOrders/:purchase_order_id", controller.DeleteDocument("purchaseOrders"))
+	incomingRoutes.POST("/purchaseOrders/:purchase_order_id/restore", controller.RestoreDocument("purchaseOrders"))
+	incomingRoutes.GET("/purchaseOrders-suggested", controller.GetSuggestedPurchaseOrders())
+	incomingRoutes.POST("/purchaseOrders-suggested", controller.CreateSuggestedPurchaseOrders())
+}
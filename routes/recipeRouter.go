@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func RecipeRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/recipes", controller.GetRecipes())
+	incomingRoutes.GET("/recipes/:food_id", controller.GetRecipe())
+	incomingRoutes.POST("/recipes", controller.SaveRecipe())
+}
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func ReportRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/reports/sales", controller.GetSalesReport())
+	incomingRoutes.GET("/reports/menuEngineering", controller.GetMenuEngineeringReport())
+}
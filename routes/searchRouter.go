@@ -0,0 +1,10 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func SearchRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/search", controller.Search())
+}
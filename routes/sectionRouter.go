@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func SectionRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/sections", controller.GetSections())
+	incomingRoutes.GET("/sections/:section_id", controller.GetSection())
+	incomingRoutes.POST("/sections", controller.CreateSection())
+	incomingRoutes.PATCH("/sections/:section_id", controller.UpdateSection())
+	incomingRoutes.DELETE("/sections/:section_id", controller.DeleteDocument("sections"))
+	incomingRoutes.POST("/sections/:section_id/restore", controller.RestoreDocument("sections"))
+	incomingRoutes.GET("/sectionAssignments", controller.GetSectionAssignments())
+	incomingRoutes.POST("/sectionAssignments", controller.CreateSectionAssignment())
+	incomingRoutes.DELETE("/sectionAssignments/:assignment_id", controller.DeleteDocument("sectionAssignments"))
+	incomingRoutes.POST("/sectionAssignments/:assignment_id/restore", controller.RestoreDocument("sectionAssignments"))
+}
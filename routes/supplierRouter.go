@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func SupplierRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/suppliers", controller.GetSuppliers())
+	incomingRoutes.GET("/suppliers/:supplier_id", controller.GetSupplier())
+	incomingRoutes.GET("/suppliers/:supplier_id/prices", controller.GetSupplierPrices())
+	incomingRoutes.POST("/suppliers", controller.CreateSupplier())
+	incomingRoutes.PATCH("/suppliers/:supplier_id", controller.UpdateSupplier())
+	incomingRoutes.DELETE("/suppliers/:supplier_id", controller.DeleteDocument("suppliers"))
+	incomingRoutes.POST("/suppliers/:supplier_id/restore", controller.RestoreDocument("suppliers"))
+}
@@ -10,4 +10,10 @@ func TableRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/tables/:table_id", controller.GetTable())
 	incomingRoutes.POST("/tables", controller.CreateTable())
 	incomingRoutes.POST("/tables/:table_id", controller.UpdateTable())
+	incomingRoutes.DELETE("/tables/:table_id", controller.DeleteDocument("tables"))
+	incomingRoutes.POST("/tables/:table_id/restore", controller.RestoreDocument("tables"))
+	incomingRoutes.GET("/tables/:table_id/qr", controller.GetTableQRCode())
+	incomingRoutes.POST("/tables/:table_id/qr/rotate", controller.RotateTableQRToken())
+	incomingRoutes.POST("/tables/:table_id/transfer", controller.TransferTable())
+	incomingRoutes.GET("/floor", controller.GetFloorPlan())
 }
@@ -11,3 +11,11 @@ func UserRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.POST("/users/signup", controller.SignUp())
 	incomingRoutes.POST("/users/login", controller.Login())
 }
+
+// UserAdminRoutes are the user routes that need a signed in user, so they are
+// registered after the authentication middleware.
+func UserAdminRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.PATCH("/users/:user_id/role", controller.UpdateUserRole())
+	incomingRoutes.DELETE("/users/:user_id", controller.DeleteDocument("users"))
+	incomingRoutes.POST("/users/:user_id/restore", controller.RestoreDocument("users"))
+}
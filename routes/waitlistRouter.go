@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "golang-restrogo/controllers"
+)
+
+func WaitlistRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/waitlist", controller.GetWaitlist())
+	incomingRoutes.GET("/waitlist/:waitlist_id", controller.GetWaitlistEntry())
+	incomingRoutes.POST("/waitlist", controller.CreateWaitlistEntry())
+	incomingRoutes.PATCH("/waitlist/:waitlist_id", controller.UpdateWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_id/seat", controller.SeatWaitlistEntry())
+	incomingRoutes.DELETE("/waitlist/:waitlist_id", controller.DeleteDocument("waitlist"))
+	incomingRoutes.POST("/waitlist/:waitlist_id/restore", controller.RestoreDocument("waitlist"))
+}
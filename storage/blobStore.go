@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// BlobStore keeps uploaded files, such as food images, and tells where they
+// can be downloaded from.
+type BlobStore interface {
+	// Put stores body under key, replacing what was there, and returns the
+	// URL the file is served from.
+	Put(ctx context.Context, key string, body []byte, contentType string) (string, error)
+	// Delete removes the file stored under key. Missing files are not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// BlobInstance picks the store from STORAGE_BACKEND: "local" (the default)
+// or "s3" for AWS S3 or an S3-compatible server such as MinIO.
+func BlobInstance() BlobStore {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		return NewLocalStore(getenv("UPLOAD_DIR", "uploads"), getenv("UPLOAD_URL", "/uploads"))
+	case "s3":
+		store, err := NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    getenv("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return store
+	default:
+		log.Fatalf("unknown STORAGE_BACKEND %q", backend)
+		return nil
+	}
+}
+
+var Store BlobStore = BlobInstance()
+
+// IsStoredURL reports whether url points at a file of the local store. Its
+// URLs are relative to the server unless UPLOAD_URL says otherwise, so they
+// are not URLs a validator would accept.
+func IsStoredURL(url string) bool {
+	local, ok := Store.(*LocalStore)
+	return ok && local.Serves(url)
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
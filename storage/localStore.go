@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps files in a directory on the server's disk. main serves
+// the directory under URLPrefix.
+type LocalStore struct {
+	Dir       string
+	URLPrefix string
+}
+
+func NewLocalStore(dir, urlPrefix string) *LocalStore {
+	return &LocalStore{Dir: dir, URLPrefix: strings.TrimRight(urlPrefix, "/")}
+}
+
+func (store *LocalStore) Put(ctx context.Context, key string, body []byte, contentType string) (string, error) {
+	file := store.path(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", err
+	}
+
+	// Write next to the target and rename, so readers never see half a file.
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	return store.URLPrefix + "/" + key, nil
+}
+
+// Serves reports whether url is where the store serves one of its files.
+func (store *LocalStore) Serves(url string) bool {
+	return strings.HasPrefix(url, store.URLPrefix+"/")
+}
+
+func (store *LocalStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(store.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path maps a key inside Dir; cleaning it as an absolute path first keeps
+// keys with ".." from escaping the directory.
+func (store *LocalStore) path(key string) string {
+	return filepath.Join(store.Dir, filepath.FromSlash(path.Clean("/"+key)))
+}